@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	AcmeChallengeHttp    = "http-01"
+	AcmeChallengeTlsAlpn = "tls-alpn-01"
+
+	AcmeDirectoryDefault = "https://acme-v02.api.letsencrypt.org/directory"
+
+	acmeTlsAlpnProto   = "acme-tls/1"
+	acmeHttpPathPrefix = "/.well-known/acme-challenge/"
+	acmeDirName        = "acme"
+	acmeAccountKeyName = "account.key"
+
+	acmeRenewBefore    = 30 * 24 * time.Hour
+	acmeCheckInterval  = 12 * time.Hour
+	acmeRetryInterval  = time.Minute
+	acmeRetryMax       = time.Hour
+	acmePollTimeout    = 3 * time.Minute
+	acmeRequestTimeout = 30 * time.Second
+)
+
+func AcmeChallengeOptions() []string {
+	return []string{AcmeChallengeHttp, AcmeChallengeTlsAlpn}
+}
+
+// AcmeInfoCheck validates the acme settings before the server starts
+func AcmeInfoCheck(info AcmeInfo) error {
+	if info.DirectoryURL == "" {
+		return fmt.Errorf("please configure the acme directory url")
+	}
+	if len(info.Domains) == 0 {
+		return fmt.Errorf("please configure at least one acme domain")
+	}
+	switch info.Challenge {
+	case AcmeChallengeHttp:
+		if info.HttpPort <= 0 || info.HttpPort > 65535 {
+			return fmt.Errorf("invalid acme http port %d", info.HttpPort)
+		}
+	case AcmeChallengeTlsAlpn:
+	default:
+		return fmt.Errorf("unknown acme challenge %s", info.Challenge)
+	}
+	if info.DirectoryCA != "" {
+		if _, err := ClientCAPool(info.DirectoryCA); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acmeManager keeps the certificate of the configured domains issued by
+// the acme directory, it is cached in the config dir and renewed in the
+// background while the server runs.
+type acmeManager struct {
+	sync.RWMutex
+
+	info     AcmeInfo
+	cacheDir string
+	cert     *tls.Certificate
+
+	tokens map[string]string
+	alpn   map[string]*tls.Certificate
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	server    *http.Server
+	httpsPort int64
+
+	sync.WaitGroup
+}
+
+func newAcmeManager(info AcmeInfo) (*acmeManager, error) {
+	err := AcmeInfoCheck(info)
+	if err != nil {
+		return nil, err
+	}
+	cacheDir := filepath.Join(ConfigDirGet(), acmeDirName)
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &acmeManager{
+		info:     info,
+		cacheDir: cacheDir,
+		tokens:   make(map[string]string),
+		alpn:     make(map[string]*tls.Certificate),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	m.cert, err = m.cacheLoad()
+	if err != nil && !os.IsNotExist(err) {
+		logs.Warning("acme cached certificate unusable, %s", err.Error())
+	}
+	return m, nil
+}
+
+func (m *acmeManager) cachePath(ext string) string {
+	name := strings.ReplaceAll(strings.ToLower(m.info.Domains[0]), "*", "_")
+	return filepath.Join(m.cacheDir, name+ext)
+}
+
+// cacheLoad returns the cached certificate when it still covers all domains
+func (m *acmeManager) cacheLoad() (*tls.Certificate, error) {
+	certPem, err := os.ReadFile(m.cachePath(".crt"))
+	if err != nil {
+		return nil, err
+	}
+	keyPem, err := os.ReadFile(m.cachePath(".key"))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range m.info.Domains {
+		if err := leaf.VerifyHostname(domain); err != nil {
+			return nil, err
+		}
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
+
+func (m *acmeManager) accountKey() (*ecdsa.PrivateKey, error) {
+	keyPath := filepath.Join(m.cacheDir, acmeAccountKeyName)
+	value, err := os.ReadFile(keyPath)
+	if err == nil {
+		block, _ := pem.Decode(value)
+		if block == nil {
+			return nil, fmt.Errorf("acme account key %s is not pem", keyPath)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (m *acmeManager) httpClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if m.info.DirectoryCA != "" {
+		pool, err := ClientCAPool(m.info.DirectoryCA)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: transport, Timeout: acmeRequestTimeout}, nil
+}
+
+// GetCertificate is tls.Config.GetCertificate, it answers the tls-alpn-01
+// validation with the challenge certificate of the requested domain.
+func (m *acmeManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, proto := range hello.SupportedProtos {
+		if proto != acmeTlsAlpnProto {
+			continue
+		}
+		cert, ok := m.alpn[strings.ToLower(hello.ServerName)]
+		if !ok {
+			return nil, fmt.Errorf("no acme challenge for %s", hello.ServerName)
+		}
+		return cert, nil
+	}
+	if m.cert == nil {
+		return nil, fmt.Errorf("acme certificate of %s is not issued yet", strings.Join(m.info.Domains, ","))
+	}
+	return m.cert, nil
+}
+
+func (m *acmeManager) Certificate() *tls.Certificate {
+	m.RLock()
+	defer m.RUnlock()
+	return m.cert
+}
+
+// ServeHTTP answers the http-01 validation, other requests to the plain
+// http port are sent to the https port.
+func (m *acmeManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, acmeHttpPathPrefix) {
+		m.RLock()
+		keyAuth, ok := m.tokens[strings.TrimPrefix(r.URL.Path, acmeHttpPathPrefix)]
+		m.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(keyAuth))
+		return
+	}
+	httpsRedirect(w, r, m.httpsPort)
+}
+
+// renewAt is when the certificate is renewed, a third of its lifetime or
+// thirty days before it expires whichever comes later.
+func (m *acmeManager) renewAt() time.Time {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.cert == nil || m.cert.Leaf == nil {
+		return time.Now()
+	}
+	before := m.cert.Leaf.NotAfter.Sub(m.cert.Leaf.NotBefore) / 3
+	if before > acmeRenewBefore {
+		before = acmeRenewBefore
+	}
+	return m.cert.Leaf.NotAfter.Add(-before)
+}
+
+// client is the acme client of the account key, the directory is looked
+// up on the first request.
+func (m *acmeManager) client() (*acme.Client, error) {
+	httpClient, err := m.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	key, err := m.accountKey()
+	if err != nil {
+		return nil, err
+	}
+	return &acme.Client{Key: key, HTTPClient: httpClient, DirectoryURL: m.info.DirectoryURL}, nil
+}
+
+// register creates the account of the key, an existing one is kept
+func (m *acmeManager) register(client *acme.Client) error {
+	account := &acme.Account{}
+	if m.info.Email != "" {
+		account.Contact = []string{"mailto:" + m.info.Email}
+	}
+	_, err := client.Register(m.ctx, account, acme.AcceptTOS)
+	if errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil
+	}
+	return err
+}
+
+func (m *acmeManager) challengeSet(client *acme.Client, domain string, challenge *acme.Challenge) error {
+	switch challenge.Type {
+	case AcmeChallengeHttp:
+		keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		m.Lock()
+		m.tokens[challenge.Token] = keyAuth
+		m.Unlock()
+	case AcmeChallengeTlsAlpn:
+		cert, err := client.TLSALPN01ChallengeCert(challenge.Token, domain)
+		if err != nil {
+			return err
+		}
+		m.Lock()
+		m.alpn[domain] = &cert
+		m.Unlock()
+	}
+	return nil
+}
+
+func (m *acmeManager) challengeClear(domain string, challenge *acme.Challenge) {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.tokens, challenge.Token)
+	delete(m.alpn, domain)
+}
+
+func (m *acmeManager) authorize(client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(m.ctx, url)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, item := range authz.Challenges {
+		if item.Type == m.info.Challenge {
+			challenge = item
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("acme offers no %s challenge for %s", m.info.Challenge, authz.Identifier.Value)
+	}
+
+	domain := strings.ToLower(authz.Identifier.Value)
+	if err := m.challengeSet(client, domain, challenge); err != nil {
+		return err
+	}
+	defer m.challengeClear(domain, challenge)
+
+	if _, err := client.Accept(m.ctx, challenge); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, acmePollTimeout)
+	defer cancel()
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("acme %s challenge for %s failed, %w", challenge.Type, domain, err)
+	}
+	return nil
+}
+
+// obtain runs a new order for the domains and caches the certificate
+func (m *acmeManager) obtain() error {
+	client, err := m.client()
+	if err != nil {
+		return err
+	}
+	if err := m.register(client); err != nil {
+		return err
+	}
+
+	order, err := client.AuthorizeOrder(m.ctx, acme.DomainIDs(m.info.Domains...))
+	if err != nil {
+		return err
+	}
+	for _, url := range order.AuthzURLs {
+		if err := m.authorize(client, url); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, acmePollTimeout)
+	defer cancel()
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return err
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.info.Domains[0]},
+		DNSNames: m.info.Domains,
+	}, certKey)
+	if err != nil {
+		return err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+
+	certPem := make([]byte, 0)
+	for _, der := range chain {
+		certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return m.certSave(certPem, certKey)
+}
+
+func (m *acmeManager) certSave(certPem []byte, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.cachePath(".key"), keyPem, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.cachePath(".crt"), certPem, 0644); err != nil {
+		return err
+	}
+
+	m.Lock()
+	m.cert = &cert
+	m.Unlock()
+
+	logs.Info("acme certificate of %s issued, valid until %s",
+		strings.Join(m.info.Domains, ","), cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+func (m *acmeManager) run() {
+	defer m.Done()
+
+	retry := acmeRetryInterval
+	for {
+		wait := time.Until(m.renewAt())
+		if wait <= 0 {
+			err := m.obtain()
+			if err == nil {
+				retry = acmeRetryInterval
+				continue
+			}
+			if m.ctx.Err() != nil {
+				return
+			}
+			logs.Error("acme certificate of %s fail, retry after %s, %s",
+				strings.Join(m.info.Domains, ","), retry, err.Error())
+			wait = retry
+			retry *= 2
+			if retry > acmeRetryMax {
+				retry = acmeRetryMax
+			}
+		}
+		if wait > acmeCheckInterval {
+			wait = acmeCheckInterval
+		}
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Start listens for the http-01 validation when needed and keeps the
+// certificate renewed until Close, other plain http requests are sent to
+// httpsPort. shared means the http listener of the file server already
+// answers the validation on that port. Addresses that fail to bind are
+// returned and skipped, only failing all of them is an error.
+func (m *acmeManager) Start(addrs []string, httpsPort int64, shared bool) ([]string, error) {
+	m.httpsPort = httpsPort
+	var failures []string
+	if m.info.Challenge == AcmeChallengeHttp && !shared {
+		listens, listenFailures, err := listenTcp(addrs, m.info.HttpPort)
+		failures = listenFailures
+		if err != nil {
+			return failures, err
+		}
+		m.server = &http.Server{Handler: m, ReadTimeout: acmeRequestTimeout, WriteTimeout: acmeRequestTimeout}
+		for _, listen := range listens {
+			m.Add(1)
+			go func(listen net.Listener) {
+				defer m.Done()
+				err := m.server.Serve(listen)
+				if err != nil && err != http.ErrServerClosed {
+					logs.Error("acme http challenge server fail, %s", err.Error())
+				}
+			}(listen)
+		}
+	}
+	m.Add(1)
+	go m.run()
+	return failures, nil
+}
+
+func (m *acmeManager) Close() {
+	m.cancel()
+	if m.server != nil {
+		m.server.Close()
+	}
+	m.Wait()
+}
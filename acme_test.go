@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+func testAcmeManager(t *testing.T, challenge string) (*acmeManager, *acme.Client) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &acmeManager{
+		info:      AcmeInfo{Domains: []string{"files.test"}, Challenge: challenge, HttpPort: 80},
+		tokens:    make(map[string]string),
+		alpn:      make(map[string]*tls.Certificate),
+		httpsPort: 8443,
+	}
+	return m, &acme.Client{Key: key}
+}
+
+func TestAcmeServeHTTP(t *testing.T) {
+	m, client := testAcmeManager(t, AcmeChallengeHttp)
+	challenge := &acme.Challenge{Type: AcmeChallengeHttp, Token: "token-1"}
+	if err := m.challengeSet(client, "files.test", challenge); err != nil {
+		t.Fatal(err)
+	}
+	keyAuth, err := client.HTTP01ChallengeResponse("token-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := testServe(t, m, http.MethodGet, "http://files.test"+acmeHttpPathPrefix+"token-1", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != keyAuth {
+		t.Errorf("challenge = %d %q, want %q", w.Code, w.Body.String(), keyAuth)
+	}
+	if w := testServe(t, m, http.MethodGet, "http://files.test"+acmeHttpPathPrefix+"token-2", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown challenge = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	m.challengeClear("files.test", challenge)
+	if w := testServe(t, m, http.MethodGet, "http://files.test"+acmeHttpPathPrefix+"token-1", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("cleared challenge = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	tests := []struct {
+		port   int64
+		target string
+		want   string
+	}{
+		{8443, "http://files.test/docs/a%20b.txt?zip=1", "https://files.test:8443/docs/a%20b.txt?zip=1"},
+		{8443, "http://files.test:80/", "https://files.test:8443/"},
+		{443, "http://files.test:80/a.txt", "https://files.test/a.txt"},
+		{443, "http://[::1]:80/a.txt", "https://[::1]/a.txt"},
+		{8443, "http://[::1]/a.txt", "https://[::1]:8443/a.txt"},
+	}
+	for _, test := range tests {
+		m.httpsPort = test.port
+		w := testServe(t, m, http.MethodGet, test.target, "", nil)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.want {
+			t.Errorf("GET %s with https on %d = %d %q, want %q", test.target, test.port, w.Code, w.Header().Get("Location"), test.want)
+		}
+	}
+}
+
+func TestAcmeGetCertificate(t *testing.T) {
+	m, client := testAcmeManager(t, AcmeChallengeTlsAlpn)
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "files.test"}); err == nil {
+		t.Error("GetCertificate before the certificate is issued succeeded")
+	}
+
+	challenge := &acme.Challenge{Type: AcmeChallengeTlsAlpn, Token: "token-1"}
+	if err := m.challengeSet(client, "files.test", challenge); err != nil {
+		t.Fatal(err)
+	}
+	hello := &tls.ClientHelloInfo{ServerName: "Files.Test", SupportedProtos: []string{acmeTlsAlpnProto}}
+	cert, err := m.GetCertificate(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "files.test" {
+		t.Errorf("challenge certificate names = %v", leaf.DNSNames)
+	}
+	hello.ServerName = "other.test"
+	if _, err := m.GetCertificate(hello); err == nil {
+		t.Error("GetCertificate of a domain without a challenge succeeded")
+	}
+
+	issued, _, _ := testCert(t, &x509.Certificate{DNSNames: []string{"files.test"}}, nil)
+	m.cert = issued
+	got, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "files.test", SupportedProtos: []string{"h2", "http/1.1"}})
+	if err != nil || got != issued {
+		t.Errorf("GetCertificate = %v, %v, want the issued certificate", got, err)
+	}
+}
+
+func TestAcmeRenewAt(t *testing.T) {
+	m, _ := testAcmeManager(t, AcmeChallengeHttp)
+	if wait := time.Until(m.renewAt()); wait > time.Second {
+		t.Errorf("renewAt without a certificate is in %s, want now", wait)
+	}
+
+	tests := []struct {
+		lifetime time.Duration
+		before   time.Duration
+	}{
+		{90 * 24 * time.Hour, 30 * 24 * time.Hour},
+		{300 * 24 * time.Hour, acmeRenewBefore},
+		{6 * 24 * time.Hour, 2 * 24 * time.Hour},
+	}
+	for _, test := range tests {
+		now := time.Now().Truncate(time.Second)
+		m.cert = &tls.Certificate{Leaf: &x509.Certificate{NotBefore: now, NotAfter: now.Add(test.lifetime)}}
+		if got, want := m.renewAt(), now.Add(test.lifetime-test.before); !got.Equal(want) {
+			t.Errorf("renewAt of a %s certificate = %s, want %s", test.lifetime, got, want)
+		}
+	}
+}
+
+func TestAcmeInfoCheck(t *testing.T) {
+	valid := AcmeInfo{DirectoryURL: AcmeDirectoryDefault, Domains: []string{"files.test"}, Challenge: AcmeChallengeHttp, HttpPort: 80}
+	if err := AcmeInfoCheck(valid); err != nil {
+		t.Errorf("AcmeInfoCheck = %v", err)
+	}
+	for _, modify := range []func(*AcmeInfo){
+		func(info *AcmeInfo) { info.DirectoryURL = "" },
+		func(info *AcmeInfo) { info.Domains = nil },
+		func(info *AcmeInfo) { info.HttpPort = 0 },
+		func(info *AcmeInfo) { info.Challenge = "dns-01" },
+		func(info *AcmeInfo) { info.DirectoryCA = "not a certificate" },
+	} {
+		info := valid
+		modify(&info)
+		if err := AcmeInfoCheck(info); err == nil {
+			t.Errorf("AcmeInfoCheck(%+v) succeeded", info)
+		}
+	}
+}
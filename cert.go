@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	CertKeyEcdsa   = "ecdsa-p256"
+	CertKeyEd25519 = "ed25519"
+	CertKeyRsa     = "rsa-2048"
+
+	certOrganization = "simple http server windows app"
+
+	certAuthorityCertName = "ca.crt"
+	certAuthorityKeyName  = "ca.key"
+	certAuthorityYears    = 10
+)
+
+var certAuthorityLock sync.Mutex
+
+func CertKeyOptions() []string {
+	return []string{CertKeyEcdsa, CertKeyEd25519, CertKeyRsa}
+}
+
+// CertOptions are the choices of the certificate generator, DNSNames may
+// hold extra host names or addresses the server is reached by.
+type CertOptions struct {
+	KeyType  string
+	DNSNames []string
+	Days     int64
+	SignByCA bool
+}
+
+func CertNamesParse(value string) []string {
+	output := make([]string, 0)
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' '
+	}) {
+		output = append(output, strings.TrimSpace(item))
+	}
+	return output
+}
+
+// certHosts collects the SANs of a server certificate, the loopback and
+// interface addresses, the host name and the names given by the user.
+func certHosts(names []string) ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	ips := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	for _, addr := range InterfaceOptions() {
+		ip := net.ParseIP(addr)
+		if ip == nil || ip.IsUnspecified() {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			ips = append(ips, ip)
+		} else if name != "" {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+
+	dnsOutput := make([]string, 0, len(dnsNames))
+	for _, name := range dnsNames {
+		if !permissionHas(dnsOutput, strings.ToLower(name)) {
+			dnsOutput = append(dnsOutput, strings.ToLower(name))
+		}
+	}
+	ipOutput := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		var exist bool
+		for _, item := range ipOutput {
+			if item.Equal(ip) {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			ipOutput = append(ipOutput, ip)
+		}
+	}
+	return dnsOutput, ipOutput
+}
+
+// certCommonName is the host name, clients only look at the SANs anyway
+func certCommonName(dnsNames []string) string {
+	if len(dnsNames) > 1 {
+		return dnsNames[1]
+	}
+	return dnsNames[0]
+}
+
+func certKeyGenerate(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case CertKeyEcdsa, "":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case CertKeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case CertKeyRsa:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return nil, fmt.Errorf("unknown key type %s", keyType)
+}
+
+func certKeyUsage(key crypto.Signer) x509.KeyUsage {
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		return x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	}
+	return x509.KeyUsageDigitalSignature
+}
+
+func certSerialNumber() (*big.Int, error) {
+	max := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, max)
+}
+
+func certPemEncode(der []byte, key crypto.Signer) (string, string, error) {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+	return string(cert), string(keyPem), nil
+}
+
+// certServerTemplate is the leaf certificate for this machine, valid
+// from an hour ago so clients with a late clock accept it right away.
+func certServerTemplate(options CertOptions, key crypto.Signer) (*x509.Certificate, error) {
+	serialNumber, err := certSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	if options.Days <= 0 {
+		return nil, fmt.Errorf("certificate validity must be at least one day")
+	}
+	dnsNames, ips := certHosts(options.DNSNames)
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{certOrganization},
+			CommonName:   certCommonName(dnsNames),
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Duration(options.Days) * 24 * time.Hour),
+		KeyUsage:              certKeyUsage(key),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}, nil
+}
+
+// GenerateKeyCert returns a certificate and key in pem format, the
+// certificate is self signed or issued by the local certificate authority.
+func GenerateKeyCert(options CertOptions) (string, string, error) {
+	key, err := certKeyGenerate(options.KeyType)
+	if err != nil {
+		return "", "", err
+	}
+	template, err := certServerTemplate(options, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	parent, parentKey := template, key
+	if options.SignByCA {
+		parent, parentKey, err = CertAuthorityGet()
+		if err != nil {
+			return "", "", err
+		}
+		if template.NotAfter.After(parent.NotAfter) {
+			template.NotAfter = parent.NotAfter
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return "", "", err
+	}
+	return certPemEncode(der, key)
+}
+
+func certAuthorityPath(name string) string {
+	return fmt.Sprintf("%s%c%s", ConfigDirGet(), os.PathSeparator, name)
+}
+
+func certAuthorityLoad() (*x509.Certificate, crypto.Signer, error) {
+	certPem, err := os.ReadFile(certAuthorityPath(certAuthorityCertName))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPem, err := os.ReadFile(certAuthorityPath(certAuthorityKeyName))
+	if err != nil {
+		return nil, nil, err
+	}
+	pair, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("the key of the local certificate authority can not sign")
+	}
+	return cert, key, nil
+}
+
+func certAuthorityCreate() (*x509.Certificate, crypto.Signer, error) {
+	key, err := certKeyGenerate(CertKeyEcdsa)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := certSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{certOrganization},
+			CommonName:   strings.TrimSpace(fmt.Sprintf("%s local CA %s", certOrganization, hostname)),
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(certAuthorityYears, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPem, keyPem, err := certPemEncode(der, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = os.WriteFile(certAuthorityPath(certAuthorityKeyName), []byte(keyPem), 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = os.WriteFile(certAuthorityPath(certAuthorityCertName), []byte(certPem), 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	logs.Info("local certificate authority created, %s", cert.Subject.CommonName)
+	return cert, key, nil
+}
+
+// CertAuthorityGet returns the root certificate and key of the local
+// certificate authority, they are created in the config dir on first use
+// and kept, so leaf certificates can be reissued without trusting again.
+func CertAuthorityGet() (*x509.Certificate, crypto.Signer, error) {
+	certAuthorityLock.Lock()
+	defer certAuthorityLock.Unlock()
+
+	cert, key, err := certAuthorityLoad()
+	if err == nil {
+		if time.Now().After(cert.NotAfter) {
+			return nil, nil, fmt.Errorf("the local certificate authority expired at %s, remove %s to create a new one",
+				cert.NotAfter.Format("2006-01-02"), certAuthorityPath(certAuthorityCertName))
+		}
+		return cert, key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	// a new authority is created only when both files are missing, writing
+	// over the certificate the clients trust would break all of them
+	certPath := certAuthorityPath(certAuthorityCertName)
+	keyPath := certAuthorityPath(certAuthorityKeyName)
+	for _, filePath := range []string{certPath, keyPath} {
+		if _, statErr := os.Stat(filePath); !os.IsNotExist(statErr) {
+			return nil, nil, fmt.Errorf("the local certificate authority is incomplete, %s, restore the missing file or remove both %s and %s to create a new one",
+				err.Error(), certPath, keyPath)
+		}
+	}
+	return certAuthorityCreate()
+}
+
+// CertAuthorityExport writes the root certificate for the clients to trust,
+// a name ending in .der or .cer gets the binary form, any other one pem.
+func CertAuthorityExport(fileName string) error {
+	cert, _, err := CertAuthorityGet()
+	if err != nil {
+		return err
+	}
+	body := cert.Raw
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".der", ".cer":
+	default:
+		body = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return SaveToFile(fileName, body)
+}
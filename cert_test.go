@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateKeyCert(t *testing.T) {
+	for _, keyType := range CertKeyOptions() {
+		certPEM, keyPEM, err := GenerateKeyCert(CertOptions{
+			KeyType:  keyType,
+			DNSNames: []string{"Files.Test", "10.1.2.3"},
+			Days:     10,
+		})
+		if err != nil {
+			t.Fatalf("%s: GenerateKeyCert: %v", keyType, err)
+		}
+		if _, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM)); err != nil {
+			t.Fatalf("%s: X509KeyPair: %v", keyType, err)
+		}
+		block, _ := pem.Decode([]byte(certPEM))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"localhost", "files.test"} {
+			if err := cert.VerifyHostname(name); err != nil {
+				t.Errorf("%s: VerifyHostname(%s): %v", keyType, name, err)
+			}
+		}
+		for _, addr := range []string{"127.0.0.1", "::1", "10.1.2.3"} {
+			if err := cert.VerifyHostname(addr); err != nil {
+				t.Errorf("%s: VerifyHostname(%s): %v", keyType, addr, err)
+			}
+		}
+		if days := cert.NotAfter.Sub(time.Now()).Hours() / 24; days < 9.9 || days > 10 {
+			t.Errorf("%s: valid for %.1f days, want 10", keyType, days)
+		}
+		if !cert.NotBefore.Before(time.Now().Add(-time.Minute)) {
+			t.Errorf("%s: NotBefore %s is not backdated", keyType, cert.NotBefore)
+		}
+	}
+
+	if _, _, err := GenerateKeyCert(CertOptions{KeyType: CertKeyEcdsa}); err == nil {
+		t.Error("GenerateKeyCert without a validity succeeded")
+	}
+	if _, _, err := GenerateKeyCert(CertOptions{KeyType: "dsa", Days: 1}); err == nil {
+		t.Error("GenerateKeyCert of an unknown key type succeeded")
+	}
+}
+
+func TestCertHosts(t *testing.T) {
+	dnsNames, ips := certHosts([]string{"Files.Test", "files.test", "", "10.1.2.3", "127.0.0.1"})
+	if dnsNames[0] != "localhost" || dnsNames[len(dnsNames)-1] != "files.test" {
+		t.Errorf("dns names = %v", dnsNames)
+	}
+	var count int
+	for _, ip := range ips {
+		if ip.Equal(net.ParseIP("127.0.0.1")) {
+			count++
+		}
+	}
+	if count != 1 || !ips[len(ips)-1].Equal(net.ParseIP("10.1.2.3")) {
+		t.Errorf("ips = %v", ips)
+	}
+	if got := CertNamesParse("a.test, b.test;10.0.0.1  c.test"); !reflect.DeepEqual(got, []string{"a.test", "b.test", "10.0.0.1", "c.test"}) {
+		t.Errorf("CertNamesParse = %v", got)
+	}
+}
+
+func TestCertAuthority(t *testing.T) {
+	home := DEFAULT_HOME
+	DEFAULT_HOME = t.TempDir()
+	defer func() { DEFAULT_HOME = home }()
+
+	certPEM, _, err := GenerateKeyCert(CertOptions{KeyType: CertKeyEd25519, DNSNames: []string{"files.test"}, Days: 30, SignByCA: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _, err := CertAuthorityGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(certPEM))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "files.test", Roots: roots}); err != nil {
+		t.Errorf("issued cert does not verify against the local CA: %v", err)
+	}
+
+	// the authority is kept for the next certificate
+	again, _, err := CertAuthorityGet()
+	if err != nil || !again.Equal(ca) {
+		t.Errorf("CertAuthorityGet again = %v, want the same CA", err)
+	}
+
+	pemPath := filepath.Join(t.TempDir(), "ca.pem")
+	derPath := filepath.Join(t.TempDir(), "ca.cer")
+	if err := CertAuthorityExport(pemPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := CertAuthorityExport(derPath); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := os.ReadFile(pemPath); !strings.HasPrefix(string(body), "-----BEGIN CERTIFICATE-----") {
+		t.Errorf("pem export = %q", body)
+	}
+	if body, _ := os.ReadFile(derPath); !bytes.Equal(body, ca.Raw) {
+		t.Error("der export is not the raw certificate")
+	}
+
+	// a missing key is not replaced by a new authority
+	if err := os.Remove(certAuthorityPath(certAuthorityKeyName)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := CertAuthorityGet(); err == nil {
+		t.Error("CertAuthorityGet without the key succeeded")
+	}
+	if body, _ := os.ReadFile(certAuthorityPath(certAuthorityCertName)); !strings.Contains(string(body), "CERTIFICATE") {
+		t.Error("the trusted CA certificate was overwritten")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+func ClientAuthOptions() []string {
+	return []string{ClientAuthNone, ClientAuthOptional, ClientAuthRequire}
+}
+
+// clientAuthType maps the policy of the tls dialog, "optional" verifies a
+// certificate only when the client sends one and falls back to passwords.
+func clientAuthType(policy string) tls.ClientAuthType {
+	switch policy {
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert
+	}
+	return tls.NoClientCert
+}
+
+// ClientCAPool parses the CA bundle client certificates are verified against
+func ClientCAPool(ca string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	rest := []byte(ca)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(cert)
+	}
+	if len(pool.Subjects()) == 0 {
+		return nil, fmt.Errorf("the tls ca does not contain any certificate")
+	}
+	return pool, nil
+}
+
+// clientCertNames lists the identities of a certificate a user can be
+// mapped to, the subject common name followed by the SANs.
+func clientCertNames(cert *x509.Certificate) []string {
+	names := make([]string, 0)
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
+
+// clientCert returns the client certificate verified by the tls handshake
+func clientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// clientCertName is the verified identity written to the access log
+func clientCertName(r *http.Request) string {
+	cert := clientCert(r)
+	if cert == nil {
+		return "-"
+	}
+	names := clientCertNames(cert)
+	if len(names) == 0 {
+		return cert.SerialNumber.String()
+	}
+	return names[0]
+}
+
+// certUser returns the user whose client cert matches an identity of the
+// verified certificate of the request.
+func (f *fileHandler) certUser(r *http.Request) *UserInfo {
+	cert := clientCert(r)
+	if cert == nil {
+		return nil
+	}
+	for _, name := range clientCertNames(cert) {
+		for i, user := range f.userList {
+			if user.ClientCert != "" && strings.EqualFold(user.ClientCert, name) {
+				return &f.userList[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testCert signs a certificate for template with parent, a self signed CA
+// when parent is nil. It returns the certificate with its PEM cert and key.
+func testCert(t *testing.T, template *x509.Certificate, parent *tls.Certificate) (*tls.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, any(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.Leaf, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &cert, certPEM, keyPEM
+}
+
+func testClientCert(t *testing.T, ca *tls.Certificate, cn string, modify func(*x509.Certificate)) *tls.Certificate {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+	if modify != nil {
+		modify(template)
+	}
+	cert, _, _ := testCert(t, template, ca)
+	return cert
+}
+
+func TestCertUser(t *testing.T) {
+	ca, _, _ := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test ca"}}, nil)
+	f := &fileHandler{userList: []UserInfo{
+		{UserName: "alice", ClientCert: "alice"},
+		{UserName: "bob", ClientCert: "bob.example.test"},
+		{UserName: "carol", ClientCert: "carol@example.test"},
+		{UserName: "dave", ClientCert: "spiffe://example.test/dave"},
+		{UserName: "erin", ClientCert: "10.0.0.5"},
+		{UserName: "frank"},
+	}}
+
+	tests := []struct {
+		name     string
+		cert     *tls.Certificate
+		verified bool
+		want     string
+	}{
+		{"common name", testClientCert(t, ca, "alice", nil), true, "alice"},
+		{"common name case", testClientCert(t, ca, "ALICE", nil), true, "alice"},
+		{"dns san", testClientCert(t, ca, "", func(c *x509.Certificate) {
+			c.DNSNames = []string{"bob.example.test"}
+		}), true, "bob"},
+		{"email san", testClientCert(t, ca, "someone", func(c *x509.Certificate) {
+			c.EmailAddresses = []string{"carol@example.test"}
+		}), true, "carol"},
+		{"uri san", testClientCert(t, ca, "", func(c *x509.Certificate) {
+			c.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.test", Path: "/dave"}}
+		}), true, "dave"},
+		{"ip san", testClientCert(t, ca, "", func(c *x509.Certificate) {
+			c.IPAddresses = []net.IP{net.ParseIP("10.0.0.5")}
+		}), true, "erin"},
+		{"unknown", testClientCert(t, ca, "mallory", nil), true, ""},
+		{"empty cert name does not match", testClientCert(t, ca, "", nil), true, ""},
+		{"not verified", testClientCert(t, ca, "alice", nil), false, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{test.cert.Leaf}}
+		if test.verified {
+			r.TLS.VerifiedChains = [][]*x509.Certificate{{test.cert.Leaf, ca.Leaf}}
+		}
+		var got string
+		if user := f.certUser(r); user != nil {
+			got = user.UserName
+		}
+		if got != test.want {
+			t.Errorf("%s: certUser = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestServeClientCert(t *testing.T) {
+	ca, caPEM, _ := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test ca"}}, nil)
+	other, _, _ := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other ca"}}, nil)
+	_, certPEM, keyPEM := testCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+
+	f := permissionTestHandler(t)
+	f.userList = append(f.userList, UserInfo{
+		UserName:    "robot",
+		ClientCert:  "robot",
+		Permissions: []string{PermRead},
+	})
+
+	config, err := CreateTlsConfig(TlsInfo{CA: caPEM, Cert: certPEM, Key: keyPEM, ClientAuth: ClientAuthOptional})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(f)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(cert *tls.Certificate, user, password string) (int, error) {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Leaf)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		if cert != nil {
+			client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		defer client.CloseIdleConnections()
+		r, err := http.NewRequest(http.MethodGet, server.URL+"/a.txt", nil)
+		if err != nil {
+			return 0, err
+		}
+		if user != "" {
+			r.SetBasicAuth(user, password)
+		}
+		resp, err := client.Do(r)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if code, err := get(testClientCert(t, ca, "robot", nil), "", ""); err != nil || code != http.StatusOK {
+		t.Errorf("GET with the cert of robot = %d, %v, want %d", code, err, http.StatusOK)
+	}
+	if code, err := get(testClientCert(t, ca, "mallory", nil), "", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("GET with an unmapped cert = %d, %v, want %d", code, err, http.StatusUnauthorized)
+	}
+	if code, err := get(testClientCert(t, ca, "mallory", nil), "intern", "secret"); err != nil || code != http.StatusOK {
+		t.Errorf("GET with an unmapped cert and a password = %d, %v, want %d", code, err, http.StatusOK)
+	}
+	if code, err := get(nil, "", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("GET without a cert = %d, %v, want %d", code, err, http.StatusUnauthorized)
+	}
+	// robot has no password, it only logs in by its cert
+	if code, err := get(nil, "robot", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("GET as robot with an empty password = %d, %v, want %d", code, err, http.StatusUnauthorized)
+	}
+	// the client holds back a cert the server does not list a CA for
+	if code, err := get(testClientCert(t, other, "robot", nil), "", ""); err == nil && code != http.StatusUnauthorized {
+		t.Errorf("GET with a cert of another CA = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const certFileInterval = 5 * time.Second
+
+// certFileStamp tells whether the certificate or key file was rewritten
+type certFileStamp struct {
+	CertTime time.Time
+	CertSize int64
+	KeyTime  time.Time
+	KeySize  int64
+}
+
+// certFileWatcher serves the certificate of a cert and key file pair and
+// swaps it when the files change, connections already established keep
+// the certificate they were set up with.
+type certFileWatcher struct {
+	sync.RWMutex
+
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	stamp    certFileStamp
+	failed   certFileStamp
+
+	stop chan struct{}
+	sync.WaitGroup
+}
+
+func certFileStampGet(certFile, keyFile string) (certFileStamp, error) {
+	certInfo, err := os.Stat(certFile)
+	if err != nil {
+		return certFileStamp{}, err
+	}
+	keyInfo, err := os.Stat(keyFile)
+	if err != nil {
+		return certFileStamp{}, err
+	}
+	return certFileStamp{
+		CertTime: certInfo.ModTime(),
+		CertSize: certInfo.Size(),
+		KeyTime:  keyInfo.ModTime(),
+		KeySize:  keyInfo.Size(),
+	}, nil
+}
+
+func newCertFileWatcher(certFile, keyFile string) (*certFileWatcher, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("please configure the certificate and key file on the tls edit page")
+	}
+	w := &certFileWatcher{
+		certFile: certFile,
+		keyFile:  keyFile,
+		stop:     make(chan struct{}),
+	}
+	stamp, err := certFileStampGet(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.load(stamp); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *certFileWatcher) load(stamp certFileStamp) error {
+	cert, err := tls.LoadX509KeyPair(w.certFile, w.keyFile)
+	if err != nil {
+		return err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	w.Lock()
+	w.cert = &cert
+	w.stamp = stamp
+	w.Unlock()
+	return nil
+}
+
+// reload is called on every tick, a pair written half way fails to load
+// and is tried again on the next tick, the old certificate stays in use.
+func (w *certFileWatcher) reload() {
+	stamp, err := certFileStampGet(w.certFile, w.keyFile)
+	if err != nil {
+		return
+	}
+
+	w.RLock()
+	changed := stamp != w.stamp
+	w.RUnlock()
+	if !changed {
+		return
+	}
+
+	err = w.load(stamp)
+	if err != nil {
+		if stamp != w.failed {
+			logs.Warning("reload certificate %s fail, keep the current one, %s", w.certFile, err.Error())
+			w.failed = stamp
+		}
+		return
+	}
+	logs.Info("reload certificate %s, valid until %s",
+		w.certFile, w.cert.Leaf.NotAfter.Format(time.RFC3339))
+}
+
+func (w *certFileWatcher) Certificate() *tls.Certificate {
+	w.RLock()
+	defer w.RUnlock()
+	return w.cert
+}
+
+// GetCertificate is tls.Config.GetCertificate
+func (w *certFileWatcher) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return w.Certificate(), nil
+}
+
+func (w *certFileWatcher) Start() {
+	w.Add(1)
+	go func() {
+		defer w.Done()
+		ticker := time.NewTicker(certFileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.reload()
+			}
+		}
+	}()
+}
+
+func (w *certFileWatcher) Close() {
+	close(w.stop)
+	w.Wait()
+}
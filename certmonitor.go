@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const certMonitorInterval = time.Hour
+
+// CertWarnDaysParse parses the comma separated days before expiry a
+// warning is logged at, e.g. "30,14,7,1".
+func CertWarnDaysParse(value string) ([]int64, error) {
+	output := make([]int64, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		days, err := strconv.ParseInt(item, 10, 64)
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid certificate warning day %s", item)
+		}
+		output = append(output, days)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i] > output[j] })
+	return output, nil
+}
+
+func CertWarnDaysFormat(days []int64) string {
+	items := make([]string, 0, len(days))
+	for _, day := range days {
+		items = append(items, strconv.FormatInt(day, 10))
+	}
+	return strings.Join(items, ",")
+}
+
+// certChain parses every certificate of the chain, the leaf comes first
+func certChain(cert *tls.Certificate) ([]*x509.Certificate, error) {
+	if cert == nil {
+		return nil, nil
+	}
+	chain := make([]*x509.Certificate, 0, len(cert.Certificate))
+	for _, der := range cert.Certificate {
+		item, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, item)
+	}
+	return chain, nil
+}
+
+func certName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.SerialNumber.String()
+}
+
+func certDaysLeft(cert *x509.Certificate, now time.Time) float64 {
+	return cert.NotAfter.Sub(now).Hours() / 24
+}
+
+// certExpiredCheck refuses a chain with an expired certificate unless the
+// configuration explicitly allows it.
+func certExpiredCheck(cert *tls.Certificate, allow bool) error {
+	chain, err := certChain(cert)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, item := range chain {
+		if now.Before(item.NotAfter) {
+			continue
+		}
+		if allow {
+			logs.Warning("certificate %s expired at %s, started anyway as configured",
+				certName(item), item.NotAfter.Format(time.RFC3339))
+			continue
+		}
+		return fmt.Errorf("certificate %s expired at %s", certName(item), item.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// certMonitor logs a warning when a certificate of the served chain passes
+// one of the thresholds before it expires, each threshold once per
+// certificate.
+type certMonitor struct {
+	certificate func() *tls.Certificate
+	warnDays    []int64
+	warned      map[string]int64
+
+	stop chan struct{}
+	sync.WaitGroup
+}
+
+func newCertMonitor(certificate func() *tls.Certificate, warnDays []int64) *certMonitor {
+	return &certMonitor{
+		certificate: certificate,
+		warnDays:    warnDays,
+		warned:      make(map[string]int64),
+		stop:        make(chan struct{}),
+	}
+}
+
+func (m *certMonitor) check() {
+	chain, err := certChain(m.certificate())
+	if err != nil {
+		logs.Error("parse certificate chain fail, %s", err.Error())
+		return
+	}
+	now := time.Now()
+	for _, item := range chain {
+		left := certDaysLeft(item, now)
+		if left <= 0 {
+			logs.Error("certificate %s expired at %s", certName(item), item.NotAfter.Format(time.RFC3339))
+			continue
+		}
+
+		// the smallest threshold already passed
+		var threshold int64
+		for _, days := range m.warnDays {
+			if left <= float64(days) {
+				threshold = days
+			}
+		}
+		key := item.SerialNumber.String() + "/" + certName(item)
+		if threshold == 0 {
+			continue
+		}
+		if warned, ok := m.warned[key]; ok && warned <= threshold {
+			continue
+		}
+		m.warned[key] = threshold
+		logs.Warning("certificate %s expires in %.1f days at %s",
+			certName(item), left, item.NotAfter.Format(time.RFC3339))
+	}
+}
+
+func (m *certMonitor) Start() {
+	m.Add(1)
+	go func() {
+		defer m.Done()
+		m.check()
+		ticker := time.NewTicker(certMonitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.check()
+			}
+		}
+	}()
+}
+
+func (m *certMonitor) Close() {
+	close(m.stop)
+	m.Wait()
+}
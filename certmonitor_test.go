@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertWarnDaysParse(t *testing.T) {
+	days, err := CertWarnDaysParse("7, 30,1,14,")
+	if err != nil || !reflect.DeepEqual(days, []int64{30, 14, 7, 1}) {
+		t.Errorf("CertWarnDaysParse = %v, %v", days, err)
+	}
+	if CertWarnDaysFormat(days) != "30,14,7,1" {
+		t.Errorf("CertWarnDaysFormat = %q", CertWarnDaysFormat(days))
+	}
+	for _, value := range []string{"0", "-1", "x", "7,a"} {
+		if _, err := CertWarnDaysParse(value); err == nil {
+			t.Errorf("CertWarnDaysParse(%q) succeeded", value)
+		}
+	}
+}
+
+func TestCertMonitorCheck(t *testing.T) {
+	cert, _, _ := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "files.test"}}, nil)
+	m := newCertMonitor(func() *tls.Certificate { return cert }, []int64{30, 14, 7, 1})
+
+	// the test cert lasts an hour, past every threshold, the warning is
+	// logged once for the smallest one
+	m.check()
+	m.check()
+	if len(m.warned) != 1 {
+		t.Fatalf("warned = %v", m.warned)
+	}
+	for _, threshold := range m.warned {
+		if threshold != 1 {
+			t.Errorf("warned at %d days, want 1", threshold)
+		}
+	}
+
+	if err := certExpiredCheck(cert, false); err != nil {
+		t.Errorf("certExpiredCheck of a valid cert = %v", err)
+	}
+	expired := &tls.Certificate{Certificate: [][]byte{testExpiredCert(t)}}
+	if err := certExpiredCheck(expired, false); err == nil {
+		t.Error("certExpiredCheck of an expired cert succeeded")
+	}
+	if err := certExpiredCheck(expired, true); err != nil {
+		t.Errorf("certExpiredCheck of an expired cert allowed = %v", err)
+	}
+}
+
+// testExpiredCert is a self signed certificate which expired a day ago
+func testExpiredCert(t *testing.T) []byte {
+	cert, _, _ := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "old.test"}}, nil)
+	template := *cert.Leaf
+	template.NotBefore = time.Now().Add(-48 * time.Hour)
+	template.NotAfter = time.Now().Add(-24 * time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, cert.Leaf.PublicKey, cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestServeServerStatus(t *testing.T) {
+	cert, _, _ := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "files.test"}}, nil)
+	f := permissionTestHandler(t)
+	f.allowStatus = true
+	f.server = &http.Server{TLSConfig: &tls.Config{Certificates: []tls.Certificate{*cert}}}
+	hashed, err := PasswordHash("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.userList = append(f.userList, UserInfo{UserName: "root", Password: hashed, Permissions: []string{PermAdmin}})
+
+	if w := testServe(t, f, http.MethodGet, statusPath, "", testBasicAuth("intern", "secret")); w.Code != http.StatusForbidden {
+		t.Errorf("status for a user without admin = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w := testServe(t, f, http.MethodGet, statusPath, "", testBasicAuth("root", "root"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status for admin = %d, want %d", w.Code, http.StatusOK)
+	}
+	var status statusData
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Requests == 0 || len(status.Certificates) != 1 || status.Certificates[0].Subject != "files.test" {
+		t.Errorf("status = %+v", status)
+	}
+	if days := status.Certificates[0].DaysToExpiry; days <= 0 || days > 1 {
+		t.Errorf("days to expiry = %f", days)
+	}
+
+	w = testServe(t, f, http.MethodGet, statusPath+"?"+statusFormatKey+"="+statusFormatPrometheus, "", testBasicAuth("root", "root"))
+	if !strings.Contains(w.Body.String(), `simple_http_server_cert_expiry_days{subject="files.test",chain="0"}`) ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("prometheus status = %q", w.Body.String())
+	}
+
+	// without the switch the path is an ordinary file name
+	f.allowStatus = false
+	if w := testServe(t, f, http.MethodGet, statusPath, "", testBasicAuth("root", "root")); w.Code != http.StatusNotFound {
+		t.Errorf("status switched off = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
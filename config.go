@@ -9,54 +9,201 @@ import (
 	"github.com/astaxie/beego/logs"
 )
 
+type PathRule struct {
+	Path        string
+	Permissions []string
+}
+
 type UserInfo struct {
-	UserName string
-	Password string
+	UserName    string
+	Password    string
+	Permissions []string
+	PathRules   []PathRule
+	ClientCert  string
 }
 
 type TlsInfo struct {
-	CA   string
-	Cert string
-	Key  string
+	Source     string
+	CA         string
+	Cert       string
+	Key        string
+	CertFile   string
+	KeyFile    string
+	ClientAuth string
+
+	MinVersion   string
+	CipherSuites string
+	ALPN         []string
+	SniCerts     []SniCert
+}
+
+// MountInfo publishes a folder under a url prefix with its own switches
+type MountInfo struct {
+	Route        string
+	Dir          string
+	UploadEnable bool
+	DeleteEnable bool
+	ZipEnable    bool
+	AuthEnable   bool
+	WebdavEnable bool
+}
+
+// VirtualHost serves its own folder to the requests of a host name, the
+// certificate files are offered to the clients asking for the name.
+type VirtualHost struct {
+	Host         string
+	Dir          string
+	UploadEnable bool
+	DeleteEnable bool
+	ZipEnable    bool
+	AuthEnable   bool
+	WebdavEnable bool
+	CertFile     string
+	KeyFile      string
+}
+
+// ProxyInfo forwards the requests under a url prefix to an upstream server,
+// Headers holds "Name: value" lines set on the forwarded requests.
+type ProxyInfo struct {
+	Route      string
+	Target     string
+	StripRoute bool
+	KeepHost   bool
+	AuthEnable bool
+	Insecure   bool
+	Headers    []string
+	Timeout    int64
+}
+
+type SniCert struct {
+	Host     string
+	CertFile string
+	KeyFile  string
+}
+
+type AcmeInfo struct {
+	DirectoryURL string
+	DirectoryCA  string
+	Email        string
+	Domains      []string
+	Challenge    string
+	HttpPort     int64
 }
 
 type Config struct {
 	ServerDir string
+	Mounts    []MountInfo
+	Hosts     []VirtualHost
+	Proxies   []ProxyInfo
 
 	DeleteEnable bool
 	UploadEnable bool
 
+	UploadConflict string
+
 	AuthEnable bool
 	AuthUsers  []UserInfo
 
-	ListenAddr string
-	ListenPort int64
-	Timeout    int64
+	AuthLockThreshold int64
+	AuthLockDuration  int64
+
+	AuthLoginEnable   bool
+	AuthSessionExpire int64
+
+	ListenAddr  string
+	ListenAddrs []string
+	ListenPort  int64
+	Timeout     int64
 
 	HttpsEnable bool
 	HttpsInfo   TlsInfo
-
-	ZipEnable   bool
-	AutoStartup bool
+	AcmeInfo    AcmeInfo
+
+	CertGenerate     CertOptions
+	CertWarnDays     []int64
+	CertAllowExpired bool
+
+	ZipEnable    bool
+	WebdavEnable bool
+	StatusEnable bool
+	Http2Enable  bool
+	H2cEnable    bool
+	Http3Enable  bool
+	AutoStartup  bool
+
+	HttpListenEnable bool
+	HttpListenPort   int64
+	HttpRedirect     bool
+	HstsEnable       bool
+
+	SiteEnable    bool
+	SiteCleanURLs bool
+	SiteFallback  string
 }
 
 var configCache = Config{
 	ServerDir:    "",
+	Mounts:       make([]MountInfo, 0),
+	Hosts:        make([]VirtualHost, 0),
+	Proxies:      make([]ProxyInfo, 0),
 	DeleteEnable: true,
 	UploadEnable: true,
 
+	UploadConflict: UploadConflictOverwrite,
+
 	AuthEnable: false,
 	AuthUsers:  make([]UserInfo, 0),
 
-	ListenAddr: "0.0.0.0",
-	ListenPort: 9000,
-	Timeout:    0,
+	AuthLockThreshold: 5,
+	AuthLockDuration:  300,
 
-	HttpsEnable: false,
-	HttpsInfo:   TlsInfo{CA: "", Cert: "", Key: ""},
+	AuthLoginEnable:   false,
+	AuthSessionExpire: 8 * 3600,
+
+	ListenAddr:  "0.0.0.0",
+	ListenAddrs: []string{},
+	ListenPort:  9000,
+	Timeout:     0,
 
-	ZipEnable:   false,
-	AutoStartup: false,
+	HttpsEnable: false,
+	HttpsInfo: TlsInfo{
+		Source:       TlsSourcePem,
+		CA:           "",
+		Cert:         "",
+		Key:          "",
+		ClientAuth:   ClientAuthNone,
+		MinVersion:   TlsVersion12,
+		CipherSuites: CipherProfileDefault,
+		ALPN:         []string{},
+		SniCerts:     []SniCert{},
+	},
+	AcmeInfo: AcmeInfo{
+		DirectoryURL: AcmeDirectoryDefault,
+		Domains:      []string{},
+		Challenge:    AcmeChallengeHttp,
+		HttpPort:     80,
+	},
+
+	CertGenerate:     CertOptions{KeyType: CertKeyEcdsa, DNSNames: []string{}, Days: 365},
+	CertWarnDays:     []int64{30, 14, 7, 1},
+	CertAllowExpired: false,
+
+	ZipEnable:    false,
+	WebdavEnable: false,
+	StatusEnable: false,
+	Http2Enable:  true,
+	H2cEnable:    false,
+	Http3Enable:  false,
+	AutoStartup:  false,
+
+	HttpListenEnable: false,
+	HttpListenPort:   9080,
+	HttpRedirect:     true,
+	HstsEnable:       false,
+
+	SiteEnable:    false,
+	SiteCleanURLs: false,
+	SiteFallback:  "",
 }
 
 var configFilePath string
@@ -88,6 +235,41 @@ func UserEnableSave(flag bool) error {
 	return configSyncToFile()
 }
 
+func AuthLockThresholdSave(threshold int64) error {
+	configCache.AuthLockThreshold = threshold
+	return configSyncToFile()
+}
+
+func AuthLockDurationSave(seconds int64) error {
+	configCache.AuthLockDuration = seconds
+	return configSyncToFile()
+}
+
+func AuthLoginEnableSave(flag bool) error {
+	configCache.AuthLoginEnable = flag
+	return configSyncToFile()
+}
+
+func AuthSessionExpireSave(seconds int64) error {
+	configCache.AuthSessionExpire = seconds
+	return configSyncToFile()
+}
+
+func MountsSave(mounts []MountInfo) error {
+	configCache.Mounts = mounts
+	return configSyncToFile()
+}
+
+func HostsSave(hosts []VirtualHost) error {
+	configCache.Hosts = hosts
+	return configSyncToFile()
+}
+
+func ProxiesSave(proxies []ProxyInfo) error {
+	configCache.Proxies = proxies
+	return configSyncToFile()
+}
+
 func ServerDirSave(dir string) error {
 	configCache.ServerDir = dir
 	return configSyncToFile()
@@ -103,11 +285,21 @@ func UploadEnableSave(flag bool) error {
 	return configSyncToFile()
 }
 
+func UploadConflictSave(policy string) error {
+	configCache.UploadConflict = policy
+	return configSyncToFile()
+}
+
 func ListenAddressSave(addr string) error {
 	configCache.ListenAddr = addr
 	return configSyncToFile()
 }
 
+func ListenAddrsSave(addrs []string) error {
+	configCache.ListenAddrs = addrs
+	return configSyncToFile()
+}
+
 func ListenPortSave(port int64) error {
 	configCache.ListenPort = port
 	return configSyncToFile()
@@ -128,11 +320,91 @@ func HttpsInfoSave(info TlsInfo) error {
 	return configSyncToFile()
 }
 
+func CertWarnDaysSave(days []int64) error {
+	configCache.CertWarnDays = days
+	return configSyncToFile()
+}
+
+func CertAllowExpiredSave(flag bool) error {
+	configCache.CertAllowExpired = flag
+	return configSyncToFile()
+}
+
+func StatusEnableSave(flag bool) error {
+	configCache.StatusEnable = flag
+	return configSyncToFile()
+}
+
+func Http2EnableSave(flag bool) error {
+	configCache.Http2Enable = flag
+	return configSyncToFile()
+}
+
+func H2cEnableSave(flag bool) error {
+	configCache.H2cEnable = flag
+	return configSyncToFile()
+}
+
+func Http3EnableSave(flag bool) error {
+	configCache.Http3Enable = flag
+	return configSyncToFile()
+}
+
+func HttpListenEnableSave(flag bool) error {
+	configCache.HttpListenEnable = flag
+	return configSyncToFile()
+}
+
+func HttpListenPortSave(port int64) error {
+	configCache.HttpListenPort = port
+	return configSyncToFile()
+}
+
+func HttpRedirectSave(flag bool) error {
+	configCache.HttpRedirect = flag
+	return configSyncToFile()
+}
+
+func HstsEnableSave(flag bool) error {
+	configCache.HstsEnable = flag
+	return configSyncToFile()
+}
+
+func SiteEnableSave(flag bool) error {
+	configCache.SiteEnable = flag
+	return configSyncToFile()
+}
+
+func SiteCleanURLsSave(flag bool) error {
+	configCache.SiteCleanURLs = flag
+	return configSyncToFile()
+}
+
+func SiteFallbackSave(file string) error {
+	configCache.SiteFallback = file
+	return configSyncToFile()
+}
+
+func AcmeInfoSave(info AcmeInfo) error {
+	configCache.AcmeInfo = info
+	return configSyncToFile()
+}
+
+func CertGenerateSave(options CertOptions) error {
+	configCache.CertGenerate = options
+	return configSyncToFile()
+}
+
 func ZipEnableSave(flag bool) error {
 	configCache.ZipEnable = flag
 	return configSyncToFile()
 }
 
+func WebdavEnableSave(flag bool) error {
+	configCache.WebdavEnable = flag
+	return configSyncToFile()
+}
+
 func AutoStartupSave(flag bool) error {
 	configCache.AutoStartup = flag
 	return configSyncToFile()
@@ -166,5 +438,28 @@ func ConfigInit() error {
 		return err
 	}
 
+	var migrate bool
+	for i, user := range configCache.AuthUsers {
+		if user.Permissions == nil {
+			configCache.AuthUsers[i].Permissions = PermissionDefault()
+			migrate = true
+		}
+		// a user of a client cert may go without a password, hashing the
+		// empty string would let it log in with an empty password
+		if user.Password != "" && !PasswordHashed(user.Password) {
+			hashed, err := PasswordHash(user.Password)
+			if err != nil {
+				logs.Error("hash password of user %s fail, %s", user.UserName, err.Error())
+				return err
+			}
+			configCache.AuthUsers[i].Password = hashed
+			migrate = true
+		}
+	}
+	if migrate {
+		logs.Info("config users migrate to hashed passwords and default permissions")
+		return configSyncToFile()
+	}
+
 	return nil
 }
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+	"github.com/lxn/win"
+)
+
+type HostItem struct {
+	Index    int
+	Host     string
+	Dir      string
+	Switches string
+	Cert     string
+
+	host    VirtualHost
+	checked bool
+}
+
+type HostTable struct {
+	sync.RWMutex
+
+	walk.TableModelBase
+	walk.SorterBase
+	sortColumn int
+	sortOrder  walk.SortOrder
+
+	items []*HostItem
+}
+
+func (n *HostTable) RowCount() int {
+	return len(n.items)
+}
+
+func (n *HostTable) Value(row, col int) interface{} {
+	item := n.items[row]
+	switch col {
+	case 0:
+		return item.Index
+	case 1:
+		return item.Host
+	case 2:
+		return item.Dir
+	case 3:
+		return item.Switches
+	case 4:
+		return item.Cert
+	}
+	panic("unexpected col")
+}
+
+func (n *HostTable) Checked(row int) bool {
+	return n.items[row].checked
+}
+
+func (n *HostTable) SetChecked(row int, checked bool) error {
+	n.items[row].checked = checked
+	return nil
+}
+
+func (m *HostTable) Sort(col int, order walk.SortOrder) error {
+	m.sortColumn, m.sortOrder = col, order
+	sort.SliceStable(m.items, func(i, j int) bool {
+		a, b := m.items[i], m.items[j]
+		c := func(ls bool) bool {
+			if m.sortOrder == walk.SortAscending {
+				return ls
+			}
+			return !ls
+		}
+		switch m.sortColumn {
+		case 0:
+			return c(a.Index < b.Index)
+		case 1:
+			return c(a.Host < b.Host)
+		case 2:
+			return c(a.Dir < b.Dir)
+		case 3:
+			return c(a.Switches < b.Switches)
+		case 4:
+			return c(a.Cert < b.Cert)
+		}
+		panic("unreachable")
+	})
+	return m.SorterBase.Sort(col, order)
+}
+
+var hostTable *HostTable
+var hostView *walk.TableView
+
+func HostTableInit(hosts []VirtualHost) {
+	item := make([]*HostItem, 0)
+	for i, host := range hosts {
+		item = append(item, &HostItem{
+			Index: i,
+			Host:  host.Host,
+			Dir:   host.Dir,
+			Switches: MountSwitchesFormat(MountInfo{
+				UploadEnable: host.UploadEnable,
+				DeleteEnable: host.DeleteEnable,
+				ZipEnable:    host.ZipEnable,
+				AuthEnable:   host.AuthEnable,
+				WebdavEnable: host.WebdavEnable,
+			}),
+			Cert: host.CertFile,
+			host: host,
+		})
+	}
+	hostTable.items = item
+
+	hostTable.PublishRowsReset()
+	hostTable.Sort(hostTable.sortColumn, hostTable.sortOrder)
+}
+
+// HostTableAdd adds a virtual host or updates the one with the same name
+func HostTableAdd(host VirtualHost) error {
+	hostTable.Lock()
+	defer hostTable.Unlock()
+
+	hosts := make([]VirtualHost, 0)
+	var exist bool
+	for _, item := range ConfigGet().Hosts {
+		if item.Host == host.Host {
+			item = host
+			exist = true
+		}
+		hosts = append(hosts, item)
+	}
+	if !exist {
+		hosts = append(hosts, host)
+	}
+
+	err := VirtualHostCheck(hosts)
+	if err != nil {
+		return err
+	}
+
+	HostTableInit(hosts)
+	return HostsSave(hosts)
+}
+
+func HostTableDelete() error {
+	hostTable.Lock()
+	defer hostTable.Unlock()
+
+	hosts := make([]VirtualHost, 0)
+	for _, items := range hostTable.items {
+		if !items.checked {
+			hosts = append(hosts, items.host)
+		}
+	}
+
+	if len(hosts) == len(hostTable.items) {
+		return fmt.Errorf("please select some host to delete")
+	}
+
+	HostTableInit(hosts)
+	return HostsSave(hosts)
+}
+
+func HostsAction() {
+	var dlg *walk.Dialog
+	var addPB, deletePB, acceptPB *walk.PushButton
+	var hostLine, dirLine, certLine, keyLine *walk.LineEdit
+	var uploadCheck, deleteCheck, zipCheck, authCheck, webdavCheck *walk.CheckBox
+
+	hostTable = new(HostTable)
+	HostTableInit(ConfigGet().Hosts)
+
+	_, err := Dialog{
+		AssignTo:      &dlg,
+		Title:         "Virtual Hosts Edit",
+		Icon:          walk.IconInformation(),
+		DefaultButton: &acceptPB,
+		CancelButton:  &acceptPB,
+		Size:          Size{Width: 700, Height: 420},
+		MinSize:       Size{Width: 700, Height: 420},
+		Layout:        VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: Grid{Columns: 3, MarginsZero: true},
+				Children: []Widget{
+					Label{
+						Text: "Host: ",
+					},
+					LineEdit{
+						AssignTo:    &hostLine,
+						ColumnSpan:  2,
+						Text:        "",
+						ToolTipText: "The host name of the requests, e.g. files.example.com or *.example.com",
+					},
+					Label{
+						Text: "Folder: ",
+					},
+					LineEdit{
+						AssignTo: &dirLine,
+						Text:     "",
+					},
+					PushButton{
+						MaxSize: Size{Width: 30},
+						Text:    " ... ",
+						OnClicked: func() {
+							dlgDir := new(walk.FileDialog)
+							dlgDir.FilePath = dirLine.Text()
+							dlgDir.Flags = win.OFN_EXPLORER
+							dlgDir.Title = "Please select a folder for the host"
+
+							exist, err := dlgDir.ShowBrowseFolder(dlg)
+							if err != nil {
+								logs.Error(err.Error())
+								return
+							}
+							if exist {
+								dirLine.SetText(dlgDir.FilePath)
+							}
+						},
+					},
+					Label{
+						Text: "Cert File: ",
+					},
+					LineEdit{
+						AssignTo:    &certLine,
+						ColumnSpan:  2,
+						Text:        "",
+						ToolTipText: "Optional pem certificate chain offered to the clients asking for the host name",
+					},
+					Label{
+						Text: "Key File: ",
+					},
+					LineEdit{
+						AssignTo:    &keyLine,
+						ColumnSpan:  2,
+						Text:        "",
+						ToolTipText: "Optional pem private key of the certificate",
+					},
+					Label{
+						Text: "Switches: ",
+					},
+					Composite{
+						Layout:     HBox{MarginsZero: true},
+						ColumnSpan: 2,
+						Children: []Widget{
+							CheckBox{
+								AssignTo: &uploadCheck,
+								Text:     "Upload",
+							},
+							CheckBox{
+								AssignTo: &deleteCheck,
+								Text:     "Delete",
+							},
+							CheckBox{
+								AssignTo: &zipCheck,
+								Text:     "Zip",
+							},
+							CheckBox{
+								AssignTo:    &authCheck,
+								Text:        "Auth",
+								ToolTipText: "Users of the users edit page must log in",
+							},
+							CheckBox{
+								AssignTo: &webdavCheck,
+								Text:     "WebDAV",
+							},
+							HSpacer{},
+						},
+					},
+				},
+			},
+			Label{
+				Text: "HostList: ",
+			},
+			TableView{
+				AssignTo:         &hostView,
+				AlternatingRowBG: true,
+				ColumnsOrderable: true,
+				CheckBoxes:       true,
+				Columns: []TableViewColumn{
+					{Title: "#", Width: 60},
+					{Title: "Host", Width: 150},
+					{Title: "Folder", Width: 200},
+					{Title: "Switches", Width: 130},
+					{Title: "Cert File", Width: 130},
+				},
+				StyleCell: func(style *walk.CellStyle) {
+					if style.Row()%2 == 0 {
+						style.BackgroundColor = walk.RGB(248, 248, 255)
+					} else {
+						style.BackgroundColor = walk.RGB(220, 220, 220)
+					}
+				},
+				Model: hostTable,
+				OnCurrentIndexChanged: func() {
+					index := hostView.CurrentIndex()
+					if 0 <= index && index < len(hostTable.items) {
+						host := hostTable.items[index].host
+						hostLine.SetText(host.Host)
+						dirLine.SetText(host.Dir)
+						certLine.SetText(host.CertFile)
+						keyLine.SetText(host.KeyFile)
+						uploadCheck.SetChecked(host.UploadEnable)
+						deleteCheck.SetChecked(host.DeleteEnable)
+						zipCheck.SetChecked(host.ZipEnable)
+						authCheck.SetChecked(host.AuthEnable)
+						webdavCheck.SetChecked(host.WebdavEnable)
+					}
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &addPB,
+						Text:     "Add",
+						OnClicked: func() {
+							host := VirtualHost{
+								Host:         strings.ToLower(strings.TrimSpace(hostLine.Text())),
+								Dir:          strings.TrimSpace(dirLine.Text()),
+								UploadEnable: uploadCheck.Checked(),
+								DeleteEnable: deleteCheck.Checked(),
+								ZipEnable:    zipCheck.Checked(),
+								AuthEnable:   authCheck.Checked(),
+								WebdavEnable: webdavCheck.Checked(),
+								CertFile:     strings.TrimSpace(certLine.Text()),
+								KeyFile:      strings.TrimSpace(keyLine.Text()),
+							}
+							err := HostTableAdd(host)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							hostLine.SetText("")
+							dirLine.SetText("")
+							certLine.SetText("")
+							keyLine.SetText("")
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &deletePB,
+						Text:     "Delete",
+						OnClicked: func() {
+							err := HostTableDelete()
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "Cancel",
+						OnClicked: func() {
+							dlg.Accept()
+						},
+					},
+					HSpacer{},
+				},
+			},
+		},
+	}.Run(mainWindow)
+
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Server answers http/3 on the udp port of the https listener with
+// the same handler and tls config, clients learn it from the Alt-Svc header.
+type http3Server struct {
+	conns  []net.PacketConn
+	server *http3.Server
+
+	sync.WaitGroup
+}
+
+func newHttp3Server(conns []net.PacketConn, config *tls.Config, timeout time.Duration) *http3Server {
+	return &http3Server{
+		conns: conns,
+		server: &http3.Server{
+			TLSConfig: config,
+			// 0-rtt requests can be replayed, uploads and deletes must not be
+			QUICConfig:  &quic.Config{Allow0RTT: false},
+			IdleTimeout: timeout,
+		},
+	}
+}
+
+func (h *http3Server) Start(handler http.Handler) {
+	h.server.Handler = handler
+	for _, conn := range h.conns {
+		h.Add(1)
+		go func(conn net.PacketConn) {
+			defer h.Done()
+			err := h.server.Serve(conn)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logs.Error("http3 server attach udp instance fail, %s", err.Error())
+			}
+		}(conn)
+	}
+}
+
+// AltSvc advertises the http/3 port on responses of the tcp listener
+func (h *http3Server) AltSvc(header http.Header) {
+	_ = h.server.SetQUICHeaders(header)
+}
+
+func (h *http3Server) Close() {
+	err := h.server.Close()
+	if err != nil {
+		logs.Error("http3 server ready to shut down fail, %s", err.Error())
+	}
+	for _, conn := range h.conns {
+		conn.Close()
+	}
+	h.Wait()
+}
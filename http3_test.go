@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHttp3Server(t *testing.T) {
+	ca, _, _ := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "http3 test ca"}}, nil)
+	cert, _, _ := testCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3 := newHttp3Server([]net.PacketConn{conn}, &tls.Config{Certificates: []tls.Certificate{*cert}}, time.Minute)
+	h3.Start(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	defer h3.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	transport := &http3.RoundTripper{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	defer transport.Close()
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "HTTP/3.0" {
+		t.Errorf("response = %d %q", resp.StatusCode, body)
+	}
+
+	header := http.Header{}
+	h3.AltSvc(header)
+	if want := fmt.Sprintf(`h3=":%d"`, port); !strings.HasPrefix(header.Get("Alt-Svc"), want) {
+		t.Errorf("Alt-Svc = %q, want %s", header.Get("Alt-Svc"), want)
+	}
+}
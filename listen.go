@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/astaxie/beego/logs"
+)
+
+// ListenAddresses returns the listen address followed by the extra bind
+// addresses without duplicates.
+func ListenAddresses(cfg *Config) []string {
+	output := []string{cfg.ListenAddr}
+	for _, addr := range cfg.ListenAddrs {
+		if !permissionHas(output, addr) {
+			output = append(output, addr)
+		}
+	}
+	return output
+}
+
+func ListenAddrsParse(value string) ([]string, error) {
+	output := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.Trim(strings.TrimSpace(item), "[]")
+		if item == "" {
+			continue
+		}
+		if net.ParseIP(item) == nil {
+			return nil, fmt.Errorf("bind address %s is not an ip address", item)
+		}
+		if !permissionHas(output, item) {
+			output = append(output, item)
+		}
+	}
+	return output, nil
+}
+
+// listenNetwork pins the address family when several addresses are bound,
+// go listens on both families for a wildcard and would take the port of
+// the other addresses otherwise.
+func listenNetwork(network string, addr string, addrs []string) string {
+	if len(addrs) < 2 {
+		return network
+	}
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return network + "6"
+	}
+	return network + "4"
+}
+
+// listenTcp listens on the port of every address, a failed address is
+// reported and skipped, only failing all of them is an error.
+func listenTcp(addrs []string, port int64) ([]net.Listener, []string, error) {
+	listens := make([]net.Listener, 0, len(addrs))
+	failures := make([]string, 0)
+	for _, addr := range addrs {
+		address := listenAddress(addr, port)
+		listen, err := net.Listen(listenNetwork("tcp", addr, addrs), address)
+		if err != nil {
+			logs.Error("http file server listen %s address fail, %s", address, err.Error())
+			failures = append(failures, fmt.Sprintf("tcp %s: %s", address, err.Error()))
+			continue
+		}
+		logs.Info("http file server listening on %s", address)
+		listens = append(listens, listen)
+	}
+	if len(listens) == 0 {
+		return nil, failures, fmt.Errorf("listen fail on all addresses, %s", strings.Join(failures, "; "))
+	}
+	return listens, failures, nil
+}
+
+func listenUdp(addrs []string, port int64) ([]net.PacketConn, []string, error) {
+	conns := make([]net.PacketConn, 0, len(addrs))
+	failures := make([]string, 0)
+	for _, addr := range addrs {
+		address := listenAddress(addr, port)
+		conn, err := net.ListenPacket(listenNetwork("udp", addr, addrs), address)
+		if err != nil {
+			logs.Error("http3 file server listen udp %s address fail, %s", address, err.Error())
+			failures = append(failures, fmt.Sprintf("udp %s: %s", address, err.Error()))
+			continue
+		}
+		logs.Info("http3 file server listening on udp %s", address)
+		conns = append(conns, conn)
+	}
+	if len(conns) == 0 {
+		return nil, failures, fmt.Errorf("listen udp fail on all addresses, %s", strings.Join(failures, "; "))
+	}
+	return conns, failures, nil
+}
+
+func listenClose(listens []net.Listener) {
+	for _, listen := range listens {
+		listen.Close()
+	}
+}
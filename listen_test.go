@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestListenAddrsParse(t *testing.T) {
+	addrs, err := ListenAddrsParse(" 127.0.0.1, [::1],,127.0.0.1 ")
+	if err != nil || strings.Join(addrs, ",") != "127.0.0.1,::1" {
+		t.Errorf("ListenAddrsParse = %v, %v", addrs, err)
+	}
+	if _, err := ListenAddrsParse("127.0.0.1,files.test"); err == nil {
+		t.Error("ListenAddrsParse accepted a host name")
+	}
+
+	cfg := &Config{ListenAddr: "0.0.0.0", ListenAddrs: []string{"127.0.0.1", "0.0.0.0"}}
+	if got := strings.Join(ListenAddresses(cfg), ","); got != "0.0.0.0,127.0.0.1" {
+		t.Errorf("ListenAddresses = %s", got)
+	}
+}
+
+func TestListenTcp(t *testing.T) {
+	busy, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := int64(busy.Addr().(*net.TCPAddr).Port)
+
+	listens, failures, err := listenTcp([]string{"127.0.0.1", "127.0.0.2"}, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listenClose(listens)
+	if len(listens) != 1 || listens[0].Addr().String() != listenAddress("127.0.0.2", port) {
+		t.Errorf("listens = %v", listens)
+	}
+	if len(failures) != 1 || !strings.Contains(failures[0], listenAddress("127.0.0.1", port)) {
+		t.Errorf("failures = %v", failures)
+	}
+
+	if _, failures, err := listenTcp([]string{"127.0.0.1"}, port); err == nil || len(failures) != 1 {
+		t.Errorf("listen on a busy port only = %v, %v", failures, err)
+	}
+}
+
+func TestAcmeStartListen(t *testing.T) {
+	busy, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	m, _ := testAcmeManager(t, AcmeChallengeHttp)
+	m.info.HttpPort = int64(busy.Addr().(*net.TCPAddr).Port)
+	// a fresh certificate keeps the renewal waiting
+	m.cert, _, _ = testCert(t, &x509.Certificate{DNSNames: m.info.Domains}, nil)
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	if _, err := m.Start([]string{"127.0.0.1"}, 8443, false); err == nil {
+		t.Error("Start without any challenge listener succeeded")
+	}
+
+	failures, err := m.Start([]string{"127.0.0.1", "127.0.0.2"}, 8443, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if len(failures) != 1 {
+		t.Errorf("failures = %v", failures)
+	}
+	if m.server == nil {
+		t.Error("the challenge listener was not started")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	lockoutMaxDuration = 24 * time.Hour
+	lockoutMaxShift    = 20
+	lockoutFileName    = "lockout.json"
+)
+
+type lockoutEntry struct {
+	Failures    int64
+	Lockouts    int64
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// authLockout counts failed logins per client address and per user name,
+// once a key reaches the threshold it is locked, every further lockout of
+// the same key doubles the duration. The list is kept next to config.json.
+type authLockout struct {
+	sync.Mutex
+
+	threshold int64
+	duration  time.Duration
+	filePath  string
+	entries   map[string]*lockoutEntry
+}
+
+func lockoutFilePath() string {
+	return fmt.Sprintf("%s%c%s", ConfigDirGet(), os.PathSeparator, lockoutFileName)
+}
+
+func newAuthLockout(threshold, seconds int64, filePath string) *authLockout {
+	l := &authLockout{
+		threshold: threshold,
+		duration:  time.Duration(seconds) * time.Second,
+		filePath:  filePath,
+		entries:   make(map[string]*lockoutEntry),
+	}
+	if threshold <= 0 {
+		return l
+	}
+
+	value, err := os.ReadFile(filePath)
+	if err != nil {
+		return l
+	}
+	err = json.Unmarshal(value, &l.entries)
+	if err != nil {
+		logs.Error("json unmarshal lockout list fail, %s", err.Error())
+		l.entries = make(map[string]*lockoutEntry)
+	}
+	return l
+}
+
+func lockoutKeys(r *http.Request, username string) []string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	keys := []string{"ip:" + host}
+	if username != "" {
+		keys = append(keys, "user:"+username)
+	}
+	return keys
+}
+
+// expired reports whether the entry can be dropped, the lockout count is
+// remembered for a day after the last failure.
+func (l *authLockout) expired(entry *lockoutEntry, now time.Time) bool {
+	return now.After(entry.LockedUntil) && now.Sub(entry.LastFailure) > l.duration+lockoutMaxDuration
+}
+
+func (l *authLockout) save() {
+	now := time.Now()
+	for key, entry := range l.entries {
+		if l.expired(entry, now) {
+			delete(l.entries, key)
+		}
+	}
+	value, err := json.MarshalIndent(l.entries, "\t", " ")
+	if err != nil {
+		logs.Error("json marshal lockout list fail, %s", err.Error())
+		return
+	}
+	err = os.WriteFile(l.filePath, value, 0664)
+	if err != nil {
+		logs.Error("save lockout list fail, %s", err.Error())
+	}
+}
+
+// Locked returns how long the longest lock of the keys still lasts
+func (l *authLockout) Locked(keys []string) time.Duration {
+	if l.threshold <= 0 {
+		return 0
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	var remain time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		entry, ok := l.entries[key]
+		if !ok {
+			continue
+		}
+		if left := entry.LockedUntil.Sub(now); left > remain {
+			remain = left
+		}
+	}
+	return remain
+}
+
+func (l *authLockout) Fail(keys []string) {
+	if l.threshold <= 0 {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		entry, ok := l.entries[key]
+		if !ok || l.expired(entry, now) {
+			entry = &lockoutEntry{}
+			l.entries[key] = entry
+		}
+		// failures spread wider than one lock duration do not add up
+		if now.Sub(entry.LastFailure) > l.duration {
+			entry.Failures = 0
+		}
+		entry.Failures++
+		entry.LastFailure = now
+		if entry.Failures < l.threshold {
+			continue
+		}
+
+		// the count comes from lockout.json too, shifting by a huge or
+		// negative count would overflow or panic
+		shift := entry.Lockouts
+		if shift < 0 {
+			shift = 0
+		}
+		if shift > lockoutMaxShift {
+			shift = lockoutMaxShift
+		}
+		duration := l.duration << shift
+		if duration > lockoutMaxDuration || duration <= 0 {
+			duration = lockoutMaxDuration
+		}
+		entry.Failures = 0
+		entry.Lockouts++
+		entry.LockedUntil = now.Add(duration)
+		logs.Warning("http server auth lock %s for %s after %d lockouts", key, duration, entry.Lockouts)
+	}
+	l.save()
+}
+
+func (l *authLockout) Success(keys []string) {
+	if l.threshold <= 0 {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	var changed bool
+	for _, key := range keys {
+		if _, ok := l.entries[key]; ok {
+			delete(l.entries, key)
+			changed = true
+		}
+	}
+	if changed {
+		l.save()
+	}
+}
+
+func lockoutServe(w http.ResponseWriter, remain time.Duration) {
+	seconds := int64(remain/time.Second) + 1
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	http.Error(w, fmt.Sprintf("Too many failed logins, retry after %d seconds!", seconds), http.StatusTooManyRequests)
+}
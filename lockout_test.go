@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthLockout(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), lockoutFileName)
+	l := newAuthLockout(3, 60, filePath)
+	keys := []string{"ip:10.0.0.1", "user:alice"}
+
+	l.Fail(keys)
+	l.Fail(keys)
+	if remain := l.Locked(keys); remain != 0 {
+		t.Fatalf("Locked after 2 failures = %s, want 0", remain)
+	}
+	l.Fail(keys)
+	if remain := l.Locked(keys); remain <= 0 || remain > time.Minute {
+		t.Fatalf("Locked after 3 failures = %s, want up to 1m", remain)
+	}
+	if remain := l.Locked([]string{"ip:10.0.0.2"}); remain != 0 {
+		t.Errorf("Locked of another address = %s, want 0", remain)
+	}
+	if remain := l.Locked([]string{"ip:10.0.0.2", "user:alice"}); remain <= 0 {
+		t.Errorf("Locked of alice from another address = %s, want locked", remain)
+	}
+
+	// the list survives a restart
+	if remain := newAuthLockout(3, 60, filePath).Locked(keys); remain <= 0 {
+		t.Errorf("Locked after reload = %s, want locked", remain)
+	}
+
+	l.Success(keys)
+	if remain := l.Locked(keys); remain != 0 {
+		t.Errorf("Locked after a success = %s, want 0", remain)
+	}
+
+	// disabled without a threshold
+	off := newAuthLockout(0, 60, filePath)
+	for i := 0; i < 10; i++ {
+		off.Fail(keys)
+	}
+	if remain := off.Locked(keys); remain != 0 {
+		t.Errorf("Locked with the lockout disabled = %s, want 0", remain)
+	}
+}
+
+func TestAuthLockoutDuration(t *testing.T) {
+	tests := []struct {
+		lockouts int64
+		min, max time.Duration
+	}{
+		{0, 50 * time.Second, time.Minute},
+		{1, 110 * time.Second, 2 * time.Minute},
+		{3, 470 * time.Second, 8 * time.Minute},
+		// a huge or broken count from lockout.json neither overflows
+		// nor panics
+		{64, lockoutMaxDuration - time.Minute, lockoutMaxDuration},
+		{1 << 40, lockoutMaxDuration - time.Minute, lockoutMaxDuration},
+		{-5, 50 * time.Second, time.Minute},
+	}
+	for _, test := range tests {
+		l := newAuthLockout(1, 60, filepath.Join(t.TempDir(), lockoutFileName))
+		keys := []string{"user:alice"}
+		l.entries["user:alice"] = &lockoutEntry{Lockouts: test.lockouts, LastFailure: time.Now()}
+		l.Fail(keys)
+		if remain := l.Locked(keys); remain < test.min || remain > test.max {
+			t.Errorf("Locked after %d lockouts = %s, want %s to %s", test.lockouts, remain, test.min, test.max)
+		}
+	}
+}
+
+func TestServeLockout(t *testing.T) {
+	f := permissionTestHandler(t)
+	f.lockout = newAuthLockout(2, 60, filepath.Join(t.TempDir(), lockoutFileName))
+
+	for i := 0; i < 2; i++ {
+		if w := testServe(t, f, http.MethodGet, "/a.txt", "", testBasicAuth("intern", "wrong")); w.Code != http.StatusUnauthorized {
+			t.Fatalf("GET with a wrong password = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+	w := testServe(t, f, http.MethodGet, "/a.txt", "", testBasicAuth("intern", "secret"))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("GET while locked = %d, Retry-After %q, want %d", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	if w := testServe(t, f, http.MethodGet, "/a.txt", "", testBasicAuth("bob", "hunter2")); w.Code != http.StatusTooManyRequests {
+		t.Errorf("GET of bob from the locked address = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
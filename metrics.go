@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statusPath = "/.status"
+
+	statusFormatKey        = "format"
+	statusFormatPrometheus = "prometheus"
+)
+
+type statusCertificate struct {
+	Subject      string    `json:"subject"`
+	DNSNames     []string  `json:"dns_names"`
+	NotAfter     time.Time `json:"not_after"`
+	DaysToExpiry float64   `json:"days_to_expiry"`
+}
+
+type statusData struct {
+	Version      string              `json:"version"`
+	Requests     int64               `json:"requests"`
+	Certificates []statusCertificate `json:"certificates"`
+}
+
+func (f *fileHandler) statusGet() (*statusData, error) {
+	status := &statusData{
+		Version:      VersionGet(),
+		Requests:     atomic.LoadInt64(&f.requests),
+		Certificates: make([]statusCertificate, 0),
+	}
+	chain, err := certChain(f.certificate())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, item := range chain {
+		status.Certificates = append(status.Certificates, statusCertificate{
+			Subject:      certName(item),
+			DNSNames:     item.DNSNames,
+			NotAfter:     item.NotAfter,
+			DaysToExpiry: certDaysLeft(item, now),
+		})
+	}
+	return status, nil
+}
+
+// serveServerStatus answers the status endpoint with json, or with the
+// prometheus text format for ?format=prometheus.
+func (f *fileHandler) serveServerStatus(w http.ResponseWriter, r *http.Request) error {
+	status, err := f.statusGet()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.URL.Query().Get(statusFormatKey) != statusFormatPrometheus {
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(status)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "# TYPE simple_http_server_requests_total counter\n")
+	fmt.Fprintf(&body, "simple_http_server_requests_total %d\n", status.Requests)
+	fmt.Fprintf(&body, "# TYPE simple_http_server_cert_expiry_days gauge\n")
+	for i, item := range status.Certificates {
+		fmt.Fprintf(&body, "simple_http_server_cert_expiry_days{subject=%q,chain=\"%d\"} %.3f\n",
+			item.Subject, i, item.DaysToExpiry)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err = w.Write([]byte(body.String()))
+	return err
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// RouteCheck validates the url prefix of a mount or a proxy, hidden segments
+// are kept for the login, share, status and upload paths of the server.
+func RouteCheck(route string) error {
+	if !strings.HasPrefix(route, "/") || route == "/" {
+		return fmt.Errorf("route %s must look like /name", route)
+	}
+	if path.Clean(route) != route {
+		return fmt.Errorf("route %s is not a clean path", route)
+	}
+	for _, segment := range strings.Split(route[1:], "/") {
+		if strings.HasPrefix(segment, ".") {
+			return fmt.Errorf("route %s must not have a segment starting with a dot", route)
+		}
+	}
+	return nil
+}
+
+func MountInfoCheck(mounts []MountInfo) error {
+	routes := make([]string, 0, len(mounts))
+	for _, mount := range mounts {
+		if err := RouteCheck(mount.Route); err != nil {
+			return err
+		}
+		if permissionHas(routes, mount.Route) {
+			return fmt.Errorf("mount route %s is used twice", mount.Route)
+		}
+		routes = append(routes, mount.Route)
+
+		stat, err := os.Stat(mount.Dir)
+		if err != nil {
+			return fmt.Errorf("mount %s folder %s, %s", mount.Route, mount.Dir, err.Error())
+		}
+		if !stat.IsDir() {
+			return fmt.Errorf("mount %s folder %s is not folder", mount.Route, mount.Dir)
+		}
+	}
+	return nil
+}
+
+// mountNew creates the handler of a mount, the users, sessions and share
+// links are shared with the server.
+func (f *fileHandler) mountNew(info MountInfo) *fileHandler {
+	return &fileHandler{
+		route:          info.Route,
+		host:           f.host,
+		path:           info.Dir,
+		allowUpload:    info.UploadEnable,
+		allowDelete:    info.DeleteEnable,
+		allowZip:       info.ZipEnable,
+		allowAuth:      info.AuthEnable,
+		allowWebdav:    info.WebdavEnable,
+		uploadConflict: f.uploadConflict,
+		allowSite:      f.allowSite,
+		siteCleanURLs:  f.siteCleanURLs,
+		siteFallback:   f.siteFallback,
+		locks:          newDavLockSystem(),
+		uploads:        newTusUploads(),
+		userList:       f.userList,
+		passwords:      f.passwords,
+		lockout:        f.lockout,
+		login:          f.login,
+		shares:         f.shares,
+		root:           f,
+	}
+}
+
+// mountGet returns the mount with the longest route holding the url path,
+// the server itself serves everything else.
+func (f *fileHandler) mountGet(urlPath string) *fileHandler {
+	urlPath = path.Clean("/" + urlPath)
+	for _, mount := range f.mounts {
+		if urlPath == mount.route || strings.HasPrefix(urlPath, mount.route+"/") {
+			return mount
+		}
+	}
+	return f
+}
+
+// mountPath strips the route of the mount from the url path
+func (f *fileHandler) mountPath(urlPath string) string {
+	urlPath = path.Clean("/" + urlPath)
+	if f.route == "/" {
+		return urlPath
+	}
+	return path.Clean("/" + strings.TrimPrefix(urlPath, f.route))
+}
+
+// mountFiles lists the mounts as folders of the root index
+func (f *fileHandler) mountFiles(r *http.Request) []directoryListingFileData {
+	output := make([]directoryListingFileData, 0, len(f.mounts))
+	for _, mount := range f.mounts {
+		if !mount.permit(r, mount.route, PermRead) {
+			continue
+		}
+		output = append(output, directoryListingFileData{
+			Name:  mount.route[1:] + "/",
+			IsDir: true,
+			URL:   &url.URL{Path: mount.route + "/"},
+		})
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Name < output[j].Name })
+	return output
+}
+
+// serveMounts is the index of the mounts when no server dir is shared
+func (f *fileHandler) serveMounts(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return f.serveStatus(w, r, http.StatusMethodNotAllowed)
+	}
+	var user, logout string
+	if authUser := authUserGet(r); authUser != nil && f.login != nil && shareLinkGet(r) == nil {
+		user, logout = authUser.UserName, logoutPath
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return directoryListingTemplate.Execute(w, directoryListingData{
+		Title:  "/",
+		Path:   "/",
+		Files:  f.mountFiles(r),
+		User:   user,
+		Logout: logout,
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMountGet(t *testing.T) {
+	// CreateHttpServer sorts the mounts with the longest route first
+	root := &fileHandler{route: "/"}
+	for _, route := range []string{"/docs/archive", "/media", "/docs", "/a b"} {
+		root.mounts = append(root.mounts, root.mountNew(MountInfo{Route: route}))
+	}
+
+	tests := []struct {
+		urlPath string
+		want    string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/a.txt", "/"},
+		{"/docs", "/docs"},
+		{"/docs/", "/docs"},
+		{"/docs/a.txt", "/docs"},
+		{"/docsx/a.txt", "/"},
+		{"/docs/archive", "/docs/archive"},
+		{"/docs/archive/2024/a.txt", "/docs/archive"},
+		{"/docs/archived", "/docs"},
+		{"/docs/../media/a.mp4", "/media"},
+		{"//media/a.mp4", "/media"},
+		{"/a b/c.txt", "/a b"},
+		{"/Docs/a.txt", "/"},
+	}
+	for _, test := range tests {
+		if got := root.mountGet(test.urlPath).route; got != test.want {
+			t.Errorf("mountGet(%q) = %q, want %q", test.urlPath, got, test.want)
+		}
+	}
+}
+
+func TestServeMounts(t *testing.T) {
+	f := permissionTestHandler(t)
+	media, pub := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(media, "v.txt"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pub, "p.txt"), []byte("public"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.mounts = []*fileHandler{
+		f.mountNew(MountInfo{Route: "/media", Dir: media, AuthEnable: true}),
+		f.mountNew(MountInfo{Route: "/pub", Dir: pub, DeleteEnable: true}),
+	}
+	intern := testBasicAuth("intern", "secret")
+	bob := testBasicAuth("bob", "hunter2")
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		status int
+		body   string
+	}{
+		{"mounted file", http.MethodGet, "/media/v.txt", intern, http.StatusOK, "video"},
+		{"mounted file without credentials", http.MethodGet, "/media/v.txt", nil, http.StatusUnauthorized, ""},
+		{"mounted file without read", http.MethodGet, "/media/v.txt", bob, http.StatusForbidden, ""},
+		{"missing file of a mount", http.MethodGet, "/media/a.txt", intern, http.StatusNotFound, ""},
+		{"route prefix of another name", http.MethodGet, "/mediax/v.txt", intern, http.StatusNotFound, ""},
+		{"mount without auth", http.MethodGet, "/pub/p.txt", nil, http.StatusOK, "public"},
+		{"server dir beside the mounts", http.MethodGet, "/a.txt", intern, http.StatusOK, "a.txt"},
+		{"root index lists the mounts", http.MethodGet, "/", intern, http.StatusOK, `href="/media/"`},
+		{"delete without the permission", http.MethodDelete, "/media/v.txt", intern, http.StatusForbidden, ""},
+		{"delete on a mount allowing it", http.MethodDelete, "/pub/p.txt", nil, http.StatusOK, ""},
+		{"deleted file of a mount", http.MethodGet, "/pub/p.txt", nil, http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := testServe(t, f, test.method, test.target, "", test.header)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s: %s %s = %d %q, want %d %q", test.name, test.method, test.target, w.Code, w.Body.String(), test.status, test.body)
+		}
+	}
+
+	// without a server dir the root only lists the mounts the user may read
+	f.path = ""
+	if w := testServe(t, f, http.MethodGet, "/a.txt", "", intern); w.Code != http.StatusNotFound {
+		t.Errorf("file outside the mounts = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w := testServe(t, f, http.MethodGet, "/", "", intern)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/media/"`) || !strings.Contains(w.Body.String(), `href="/pub/"`) {
+		t.Errorf("mount index = %d %q", w.Code, w.Body.String())
+	}
+	if w := testServe(t, f, http.MethodGet, "/", "", bob); strings.Contains(w.Body.String(), `href="/media/"`) {
+		t.Errorf("mount index shows /media without read permission")
+	}
+}
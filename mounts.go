@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+	"github.com/lxn/win"
+)
+
+type MountItem struct {
+	Index    int
+	Route    string
+	Dir      string
+	Switches string
+
+	mount   MountInfo
+	checked bool
+}
+
+type MountTable struct {
+	sync.RWMutex
+
+	walk.TableModelBase
+	walk.SorterBase
+	sortColumn int
+	sortOrder  walk.SortOrder
+
+	items []*MountItem
+}
+
+func (n *MountTable) RowCount() int {
+	return len(n.items)
+}
+
+func (n *MountTable) Value(row, col int) interface{} {
+	item := n.items[row]
+	switch col {
+	case 0:
+		return item.Index
+	case 1:
+		return item.Route
+	case 2:
+		return item.Dir
+	case 3:
+		return item.Switches
+	}
+	panic("unexpected col")
+}
+
+func (n *MountTable) Checked(row int) bool {
+	return n.items[row].checked
+}
+
+func (n *MountTable) SetChecked(row int, checked bool) error {
+	n.items[row].checked = checked
+	return nil
+}
+
+func (m *MountTable) Sort(col int, order walk.SortOrder) error {
+	m.sortColumn, m.sortOrder = col, order
+	sort.SliceStable(m.items, func(i, j int) bool {
+		a, b := m.items[i], m.items[j]
+		c := func(ls bool) bool {
+			if m.sortOrder == walk.SortAscending {
+				return ls
+			}
+			return !ls
+		}
+		switch m.sortColumn {
+		case 0:
+			return c(a.Index < b.Index)
+		case 1:
+			return c(a.Route < b.Route)
+		case 2:
+			return c(a.Dir < b.Dir)
+		case 3:
+			return c(a.Switches < b.Switches)
+		}
+		panic("unreachable")
+	})
+	return m.SorterBase.Sort(col, order)
+}
+
+// MountSwitchesFormat names the enabled switches of a mount
+func MountSwitchesFormat(mount MountInfo) string {
+	output := make([]string, 0)
+	for _, item := range []struct {
+		name string
+		flag bool
+	}{
+		{"upload", mount.UploadEnable},
+		{"delete", mount.DeleteEnable},
+		{"zip", mount.ZipEnable},
+		{"auth", mount.AuthEnable},
+		{"webdav", mount.WebdavEnable},
+	} {
+		if item.flag {
+			output = append(output, item.name)
+		}
+	}
+	return strings.Join(output, ",")
+}
+
+var mountTable *MountTable
+var mountView *walk.TableView
+
+func MountTableInit(mounts []MountInfo) {
+	item := make([]*MountItem, 0)
+	for i, mount := range mounts {
+		item = append(item, &MountItem{
+			Index:    i,
+			Route:    mount.Route,
+			Dir:      mount.Dir,
+			Switches: MountSwitchesFormat(mount),
+			mount:    mount,
+		})
+	}
+	mountTable.items = item
+
+	mountTable.PublishRowsReset()
+	mountTable.Sort(mountTable.sortColumn, mountTable.sortOrder)
+}
+
+// MountTableAdd adds a mount or updates the one with the same route
+func MountTableAdd(mount MountInfo) error {
+	mountTable.Lock()
+	defer mountTable.Unlock()
+
+	mounts := make([]MountInfo, 0)
+	var exist bool
+	for _, item := range ConfigGet().Mounts {
+		if item.Route == mount.Route {
+			item = mount
+			exist = true
+		}
+		mounts = append(mounts, item)
+	}
+	if !exist {
+		mounts = append(mounts, mount)
+	}
+
+	err := MountInfoCheck(mounts)
+	if err != nil {
+		return err
+	}
+	err = ProxyInfoCheck(ConfigGet().Proxies, mounts)
+	if err != nil {
+		return err
+	}
+
+	MountTableInit(mounts)
+	return MountsSave(mounts)
+}
+
+func MountTableDelete() error {
+	mountTable.Lock()
+	defer mountTable.Unlock()
+
+	mounts := make([]MountInfo, 0)
+	for _, items := range mountTable.items {
+		if !items.checked {
+			mounts = append(mounts, items.mount)
+		}
+	}
+
+	if len(mounts) == len(mountTable.items) {
+		return fmt.Errorf("please select some mount to delete")
+	}
+
+	MountTableInit(mounts)
+	return MountsSave(mounts)
+}
+
+func MountsAction() {
+	var dlg *walk.Dialog
+	var addPB, deletePB, acceptPB *walk.PushButton
+	var routeLine, dirLine *walk.LineEdit
+	var uploadCheck, deleteCheck, zipCheck, authCheck, webdavCheck *walk.CheckBox
+
+	mountTable = new(MountTable)
+	MountTableInit(ConfigGet().Mounts)
+
+	_, err := Dialog{
+		AssignTo:      &dlg,
+		Title:         "Mounted Folders Edit",
+		Icon:          walk.IconInformation(),
+		DefaultButton: &acceptPB,
+		CancelButton:  &acceptPB,
+		Size:          Size{Width: 650, Height: 360},
+		MinSize:       Size{Width: 650, Height: 360},
+		Layout:        VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: Grid{Columns: 3, MarginsZero: true},
+				Children: []Widget{
+					Label{
+						Text: "Route: ",
+					},
+					LineEdit{
+						AssignTo:    &routeLine,
+						ColumnSpan:  2,
+						Text:        "",
+						ToolTipText: "The url prefix of the folder, e.g. /builds",
+					},
+					Label{
+						Text: "Folder: ",
+					},
+					LineEdit{
+						AssignTo: &dirLine,
+						Text:     "",
+					},
+					PushButton{
+						MaxSize: Size{Width: 30},
+						Text:    " ... ",
+						OnClicked: func() {
+							dlgDir := new(walk.FileDialog)
+							dlgDir.FilePath = dirLine.Text()
+							dlgDir.Flags = win.OFN_EXPLORER
+							dlgDir.Title = "Please select a folder to mount"
+
+							exist, err := dlgDir.ShowBrowseFolder(dlg)
+							if err != nil {
+								logs.Error(err.Error())
+								return
+							}
+							if exist {
+								dirLine.SetText(dlgDir.FilePath)
+								if routeLine.Text() == "" {
+									routeLine.SetText("/" + strings.ToLower(path.Base(strings.ReplaceAll(dlgDir.FilePath, "\\", "/"))))
+								}
+							}
+						},
+					},
+					Label{
+						Text: "Switches: ",
+					},
+					Composite{
+						Layout:     HBox{MarginsZero: true},
+						ColumnSpan: 2,
+						Children: []Widget{
+							CheckBox{
+								AssignTo: &uploadCheck,
+								Text:     "Upload",
+							},
+							CheckBox{
+								AssignTo: &deleteCheck,
+								Text:     "Delete",
+							},
+							CheckBox{
+								AssignTo: &zipCheck,
+								Text:     "Zip",
+							},
+							CheckBox{
+								AssignTo:    &authCheck,
+								Text:        "Auth",
+								ToolTipText: "Users of the users edit page must log in, their path rules use the full url path",
+							},
+							CheckBox{
+								AssignTo: &webdavCheck,
+								Text:     "WebDAV",
+							},
+							HSpacer{},
+						},
+					},
+				},
+			},
+			Label{
+				Text: "MountList: ",
+			},
+			TableView{
+				AssignTo:         &mountView,
+				AlternatingRowBG: true,
+				ColumnsOrderable: true,
+				CheckBoxes:       true,
+				Columns: []TableViewColumn{
+					{Title: "#", Width: 60},
+					{Title: "Route", Width: 120},
+					{Title: "Folder", Width: 250},
+					{Title: "Switches", Width: 180},
+				},
+				StyleCell: func(style *walk.CellStyle) {
+					if style.Row()%2 == 0 {
+						style.BackgroundColor = walk.RGB(248, 248, 255)
+					} else {
+						style.BackgroundColor = walk.RGB(220, 220, 220)
+					}
+				},
+				Model: mountTable,
+				OnCurrentIndexChanged: func() {
+					index := mountView.CurrentIndex()
+					if 0 <= index && index < len(mountTable.items) {
+						mount := mountTable.items[index].mount
+						routeLine.SetText(mount.Route)
+						dirLine.SetText(mount.Dir)
+						uploadCheck.SetChecked(mount.UploadEnable)
+						deleteCheck.SetChecked(mount.DeleteEnable)
+						zipCheck.SetChecked(mount.ZipEnable)
+						authCheck.SetChecked(mount.AuthEnable)
+						webdavCheck.SetChecked(mount.WebdavEnable)
+					}
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &addPB,
+						Text:     "Add",
+						OnClicked: func() {
+							mount := MountInfo{
+								Route:        strings.TrimSuffix(strings.TrimSpace(routeLine.Text()), "/"),
+								Dir:          strings.TrimSpace(dirLine.Text()),
+								UploadEnable: uploadCheck.Checked(),
+								DeleteEnable: deleteCheck.Checked(),
+								ZipEnable:    zipCheck.Checked(),
+								AuthEnable:   authCheck.Checked(),
+								WebdavEnable: webdavCheck.Checked(),
+							}
+							err := MountTableAdd(mount)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							routeLine.SetText("")
+							dirLine.SetText("")
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &deletePB,
+						Text:     "Delete",
+						OnClicked: func() {
+							err := MountTableDelete()
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "Cancel",
+						OnClicked: func() {
+							dlg.Accept()
+						},
+					},
+					HSpacer{},
+				},
+			},
+		},
+	}.Run(mainWindow)
+
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCacheMax bounds the verify cache, an entry is dropped at random
+// when it is full.
+const passwordCacheMax = 1024
+
+// passwordDummy is verified against when the user name is unknown, so the
+// answer takes as long as for a wrong password. No password matches it.
+const passwordDummy = "$2a$10$L3y5dEZI2uICR71PI0nrNeaSR77WYZBYDl5pl4aOpi43yDgczVs6q"
+
+// PasswordHash returns the bcrypt hash of the password
+func PasswordHash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// PasswordHashed reports whether the stored value is already a hash, plain
+// text passwords of older config files are migrated on startup.
+func PasswordHashed(value string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordVerify is false for an empty stored password, such a user has
+// no password to log in with.
+func PasswordVerify(hashed, password string) bool {
+	if hashed == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+}
+
+// passwordCache remembers the credentials verified lately, basic auth sends
+// the password with each request and running bcrypt every time would make
+// browsing a folder crawl. Entries are keyed by a keyed mac of the user and
+// password, the password itself is never kept.
+type passwordCache struct {
+	sync.Mutex
+	key    []byte
+	verify map[string]string
+}
+
+func newPasswordCache() *passwordCache {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &passwordCache{key: key, verify: make(map[string]string)}
+}
+
+func (c *passwordCache) mac(user, password string) string {
+	h := hmac.New(sha256.New, c.key)
+	binary.Write(h, binary.BigEndian, uint32(len(user)))
+	h.Write([]byte(user))
+	h.Write([]byte(password))
+	return string(h.Sum(nil))
+}
+
+// Verify checks the password of user against the stored hash, a cached
+// entry only counts while the stored hash is the one it was verified with.
+func (c *passwordCache) Verify(user, hashed, password string) bool {
+	if hashed == "" {
+		return false
+	}
+	sum := c.mac(user, password)
+
+	c.Lock()
+	cached, ok := c.verify[sum]
+	c.Unlock()
+
+	if ok && cached == hashed {
+		return true
+	}
+	if !PasswordVerify(hashed, password) {
+		return false
+	}
+
+	c.Lock()
+	if len(c.verify) >= passwordCacheMax {
+		for key := range c.verify {
+			delete(c.verify, key)
+			break
+		}
+	}
+	c.verify[sum] = hashed
+	c.Unlock()
+	return true
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPasswordVerify(t *testing.T) {
+	hashed, err := PasswordHash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !PasswordHashed(hashed) {
+		t.Fatalf("PasswordHashed(%q) = false", hashed)
+	}
+	empty, err := PasswordHash("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hashed   string
+		password string
+		want     bool
+	}{
+		{hashed, "secret", true},
+		{hashed, "Secret", false},
+		{hashed, "", false},
+		{empty, "", true},
+		{"", "", false},
+		{"", "secret", false},
+		{"secret", "secret", false},
+		{passwordDummy, "", false},
+		{passwordDummy, "secret", false},
+	}
+	for _, test := range tests {
+		if got := PasswordVerify(test.hashed, test.password); got != test.want {
+			t.Errorf("PasswordVerify(%q, %q) = %v, want %v", test.hashed, test.password, got, test.want)
+		}
+	}
+}
+
+func TestPasswordHashed(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", false},
+		{"secret", false},
+		{"$2a$10$abc", true},
+		{"$2b$10$abc", true},
+		{"$2y$10$abc", true},
+		{"$2x$10$abc", false},
+		{"$argon2id$v=19$abc", false},
+	}
+	for _, test := range tests {
+		if got := PasswordHashed(test.value); got != test.want {
+			t.Errorf("PasswordHashed(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestPasswordCache(t *testing.T) {
+	hashed, err := PasswordHash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := PasswordHash("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newPasswordCache()
+
+	if !c.Verify("alice", hashed, "secret") {
+		t.Fatal("Verify(alice, secret) = false")
+	}
+	if len(c.verify) != 1 {
+		t.Fatalf("cache keeps %d entries, want 1", len(c.verify))
+	}
+	for sum := range c.verify {
+		if strings.Contains(sum, "secret") {
+			t.Errorf("cache key %q keeps the password", sum)
+		}
+	}
+
+	tests := []struct {
+		user     string
+		hashed   string
+		password string
+		want     bool
+	}{
+		{"alice", hashed, "secret", true},
+		{"alice", hashed, "Secret", false},
+		// the entry of alice does not let another user in
+		{"bob", other, "secret", false},
+		// nor does it survive a changed password
+		{"alice", other, "secret", false},
+		{"alice", other, "other", true},
+		{"alice", "", "", false},
+		{"alice", "secret", "secret", false},
+	}
+	for _, test := range tests {
+		if got := c.Verify(test.user, test.hashed, test.password); got != test.want {
+			t.Errorf("Verify(%q, %q) = %v, want %v", test.user, test.password, got, test.want)
+		}
+	}
+
+	c.verify = make(map[string]string)
+	for i := 0; i < passwordCacheMax; i++ {
+		c.verify[c.mac("user", strconv.Itoa(i))] = hashed
+	}
+	if !c.Verify("alice", hashed, "secret") {
+		t.Fatal("Verify(alice, secret) on a full cache = false")
+	}
+	if len(c.verify) != passwordCacheMax {
+		t.Errorf("cache keeps %d entries, want at most %d", len(c.verify), passwordCacheMax)
+	}
+}
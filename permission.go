@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	PermRead   = "read"
+	PermUpload = "upload"
+	PermDelete = "delete"
+	PermZip    = "zip"
+	PermShare  = "share"
+	PermAdmin  = "admin"
+)
+
+type authUserKey struct{}
+
+func PermissionOptions() []string {
+	return []string{PermRead, PermUpload, PermDelete, PermZip, PermShare, PermAdmin}
+}
+
+// PermissionDefault is given to users stored before permissions existed,
+// they keep everything the global switches allow. Sharing links has to be
+// granted explicitly.
+func PermissionDefault() []string {
+	return []string{PermRead, PermUpload, PermDelete, PermZip}
+}
+
+func PermissionFormat(perms []string) string {
+	return strings.Join(perms, ",")
+}
+
+func PermissionParse(value string) ([]string, error) {
+	output := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if !permissionHas(PermissionOptions(), item) {
+			return nil, fmt.Errorf("unknown permission %s, options are %s",
+				item, PermissionFormat(PermissionOptions()))
+		}
+		if !permissionHas(output, item) {
+			output = append(output, item)
+		}
+	}
+	return output, nil
+}
+
+// PathRulesFormat renders rules as "/path=read,zip;/other=read"
+func PathRulesFormat(rules []PathRule) string {
+	items := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		items = append(items, fmt.Sprintf("%s=%s", rule.Path, PermissionFormat(rule.Permissions)))
+	}
+	return strings.Join(items, ";")
+}
+
+func PathRulesParse(value string) ([]PathRule, error) {
+	output := make([]PathRule, 0)
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		rulePath, perms, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("path rule %s must look like /path=read,upload", item)
+		}
+		permissions, err := PermissionParse(perms)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, PathRule{
+			Path:        path.Clean("/" + strings.TrimSpace(rulePath)),
+			Permissions: permissions,
+		})
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Path < output[j].Path })
+	return output, nil
+}
+
+func permissionHas(perms []string, perm string) bool {
+	for _, item := range perms {
+		if item == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Permit reports whether the user holds perm on urlPath. The longest path
+// rule covering urlPath replaces the permissions of the user, admin holds
+// every permission everywhere.
+func (u *UserInfo) Permit(urlPath, perm string) bool {
+	if permissionHas(u.Permissions, PermAdmin) {
+		return true
+	}
+
+	perms := u.Permissions
+	match := -1
+	for _, rule := range u.PathRules {
+		root := path.Clean("/" + rule.Path)
+		if urlPath != root && !strings.HasPrefix(urlPath, strings.TrimSuffix(root, "/")+"/") {
+			continue
+		}
+		if len(root) > match {
+			match = len(root)
+			perms = rule.Permissions
+		}
+	}
+	return permissionHas(perms, perm)
+}
+
+func authUserSet(r *http.Request, user *UserInfo) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authUserKey{}, user))
+}
+
+// authUserGet returns the user who passed AuthHandler, nil when the
+// authentication is disabled.
+func authUserGet(r *http.Request) *UserInfo {
+	user, _ := r.Context().Value(authUserKey{}).(*UserInfo)
+	return user
+}
+
+// requestPermission is the permission a request needs on its own path,
+// COPY and MOVE additionally need upload on the destination.
+func requestPermission(r *http.Request) string {
+	switch {
+	case r.Method == http.MethodOptions:
+		return PermRead
+	case tusRequest(r):
+		return PermUpload
+	case r.Method == http.MethodDelete, r.Method == "MOVE":
+		return PermDelete
+	case r.Method == "COPY":
+		return PermRead
+	case r.Method == http.MethodPost, davWriteMethod(r.Method):
+		return PermUpload
+	}
+	return PermRead
+}
+
+// permit combines the global switches of the server with the permissions
+// of the authenticated user.
+func (f *fileHandler) permit(r *http.Request, urlPath, perm string) bool {
+	switch perm {
+	case PermUpload:
+		if !f.allowUpload {
+			return false
+		}
+	case PermDelete:
+		if !f.allowDelete {
+			return false
+		}
+	case PermZip:
+		if !f.allowZip {
+			return false
+		}
+	}
+	user := authUserGet(r)
+	if user == nil {
+		return true
+	}
+	return user.Permit(urlPath, perm)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserPermit(t *testing.T) {
+	user := &UserInfo{
+		UserName:    "intern",
+		Permissions: []string{PermRead, PermUpload},
+		PathRules: []PathRule{
+			{Path: "/docs", Permissions: []string{PermRead, PermDelete}},
+			{Path: "/docs/private", Permissions: nil},
+			{Path: "/drop/", Permissions: []string{PermUpload}},
+		},
+	}
+	admin := &UserInfo{
+		UserName:    "admin",
+		Permissions: []string{PermAdmin},
+		PathRules:   []PathRule{{Path: "/docs", Permissions: nil}},
+	}
+
+	tests := []struct {
+		user    *UserInfo
+		urlPath string
+		perm    string
+		want    bool
+	}{
+		{user, "/", PermRead, true},
+		{user, "/a.txt", PermUpload, true},
+		{user, "/a.txt", PermDelete, false},
+		{user, "/docs", PermDelete, true},
+		{user, "/docs/a.txt", PermDelete, true},
+		{user, "/docs/a.txt", PermUpload, false},
+		{user, "/docsx/a.txt", PermUpload, true},
+		{user, "/docs/private", PermRead, false},
+		{user, "/docs/private/a.txt", PermRead, false},
+		{user, "/docs/privatex", PermRead, true},
+		{user, "/drop", PermUpload, true},
+		{user, "/drop/a.txt", PermRead, false},
+		{user, "/a.txt", PermShare, false},
+		{admin, "/docs/a.txt", PermDelete, true},
+		{admin, "/", PermShare, true},
+	}
+	for _, test := range tests {
+		if got := test.user.Permit(test.urlPath, test.perm); got != test.want {
+			t.Errorf("%s Permit(%q, %q) = %v, want %v", test.user.UserName, test.urlPath, test.perm, got, test.want)
+		}
+	}
+}
+
+// permissionTestHandler serves a.txt, docs/a.txt and docs/private/s.txt to
+// intern, who may read and upload except below /docs, and bob who may only
+// upload.
+func permissionTestHandler(t *testing.T) *fileHandler {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "docs/a.txt", "docs/private/s.txt"} {
+		osPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(osPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(osPath, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	passwords := make(map[string]string)
+	for _, password := range []string{"secret", "hunter2"} {
+		hashed, err := PasswordHash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		passwords[password] = hashed
+	}
+	f := &fileHandler{
+		route: "/", path: dir,
+		allowAuth: true, allowUpload: true, allowDelete: true, allowZip: true,
+		uploads:   newTusUploads(),
+		passwords: newPasswordCache(),
+		lockout:   newAuthLockout(0, 0, ""),
+		userList: []UserInfo{
+			{
+				UserName:    "intern",
+				Password:    passwords["secret"],
+				Permissions: []string{PermRead, PermUpload},
+				PathRules: []PathRule{
+					{Path: "/docs", Permissions: []string{PermRead, PermDelete}},
+					{Path: "/docs/private", Permissions: nil},
+				},
+			},
+			{UserName: "bob", Password: passwords["hunter2"], Permissions: []string{PermUpload}},
+		},
+	}
+	f.root = f
+	return f
+}
+
+func testBasicAuth(user, password string) map[string]string {
+	return map[string]string{
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)),
+	}
+}
+
+func TestServePermissions(t *testing.T) {
+	f := permissionTestHandler(t)
+
+	if w := testServe(t, f, http.MethodGet, "/a.txt", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET without auth = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := testServe(t, f, http.MethodGet, "/a.txt", "", testBasicAuth("intern", "wrong")); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET with a wrong password = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		user   string
+		method string
+		target string
+		status int
+	}{
+		{"intern", http.MethodGet, "/a.txt", http.StatusOK},
+		{"intern", http.MethodGet, "/docs/a.txt", http.StatusOK},
+		{"intern", http.MethodGet, "/docs/private/s.txt", http.StatusForbidden},
+		{"intern", http.MethodGet, "/docs/private/", http.StatusForbidden},
+		{"intern", http.MethodGet, "/?" + zipKey + "=1", http.StatusOK},
+		{"intern", http.MethodGet, "/docs/?" + zipKey + "=1", http.StatusOK},
+		{"intern", http.MethodDelete, "/a.txt", http.StatusForbidden},
+		{"intern", http.MethodDelete, "/docs/private/s.txt", http.StatusForbidden},
+		{"intern", http.MethodDelete, "/docs/a.txt", http.StatusOK},
+		{"bob", http.MethodGet, "/a.txt", http.StatusForbidden},
+		{"bob", http.MethodDelete, "/a.txt", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		password := map[string]string{"intern": "secret", "bob": "hunter2"}[test.user]
+		w := testServe(t, f, test.method, test.target, "", testBasicAuth(test.user, password))
+		if w.Code != test.status {
+			t.Errorf("%s %s %s = %d, want %d", test.user, test.method, test.target, w.Code, test.status)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(f.path, "a.txt")); err != nil {
+		t.Errorf("a.txt is gone: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(f.path, "docs", "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("docs/a.txt is still there: %v", err)
+	}
+
+	// the path rule of /docs does not grant upload
+	body, contentType := testUploadBody(t, []testUploadPart{{"file", "b.txt", "b"}})
+	header := testBasicAuth("intern", "secret")
+	header["Content-Type"] = contentType
+	if w := testServe(t, f, http.MethodPost, "/docs/", body, header); w.Code != http.StatusForbidden {
+		t.Errorf("intern POST /docs/ = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := testServe(t, f, http.MethodPost, "/", body, header); w.Code != http.StatusOK {
+		t.Errorf("intern POST / = %d, want %d", w.Code, http.StatusOK)
+	}
+	if _, err := os.Stat(filepath.Join(f.path, "b.txt")); err != nil {
+		t.Errorf("b.txt was not uploaded: %v", err)
+	}
+}
+
+func TestServeTusPermissions(t *testing.T) {
+	f := permissionTestHandler(t)
+	tus := func(user, password string, header map[string]string) map[string]string {
+		output := testBasicAuth(user, password)
+		output["Tus-Resumable"] = tusVersion
+		for name, value := range header {
+			output[name] = value
+		}
+		return output
+	}
+	create := map[string]string{
+		"Upload-Length":   "5",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("t.txt")),
+	}
+
+	if w := testServe(t, f, http.MethodPost, "/docs/", "", tus("intern", "secret", create)); w.Code != http.StatusForbidden {
+		t.Errorf("intern creates an upload in /docs = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w := testServe(t, f, http.MethodPost, "/", "", tus("intern", "secret", create))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("intern creates an upload in / = %d, want %d", w.Code, http.StatusCreated)
+	}
+	location := w.Header().Get("Location")
+
+	// the stage path skips the path rules, the upload is checked against
+	// the user who created it instead
+	patch := map[string]string{"Content-Type": tusContentType, "Upload-Offset": "0"}
+	if w := testServe(t, f, http.MethodHead, location, "", tus("bob", "hunter2", nil)); w.Code != http.StatusForbidden {
+		t.Errorf("bob HEAD on the upload of intern = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := testServe(t, f, http.MethodPatch, location, "hello", tus("bob", "hunter2", patch)); w.Code != http.StatusForbidden {
+		t.Errorf("bob PATCH on the upload of intern = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := testServe(t, f, http.MethodDelete, location, "", tus("bob", "hunter2", nil)); w.Code != http.StatusForbidden {
+		t.Errorf("bob DELETE on the upload of intern = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := testServe(t, f, http.MethodPost, "/"+uploadStageDir+"/", "", tus("intern", "secret", create)); w.Code == http.StatusCreated {
+		t.Errorf("intern creates an upload in the stage folder = %d", w.Code)
+	}
+	if w := testServe(t, f, http.MethodPatch, location, "hello", tus("intern", "secret", patch)); w.Code != http.StatusNoContent {
+		t.Fatalf("intern PATCH = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if body, err := os.ReadFile(filepath.Join(f.path, "t.txt")); err != nil || string(body) != "hello" {
+		t.Errorf("uploaded file = %q, %v", body, err)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/lxn/walk"
+	. "github.com/lxn/walk/declarative"
+)
+
+type ProxyItem struct {
+	Index    int
+	Route    string
+	Target   string
+	Switches string
+
+	proxy   ProxyInfo
+	checked bool
+}
+
+type ProxyTable struct {
+	sync.RWMutex
+
+	walk.TableModelBase
+	walk.SorterBase
+	sortColumn int
+	sortOrder  walk.SortOrder
+
+	items []*ProxyItem
+}
+
+func (n *ProxyTable) RowCount() int {
+	return len(n.items)
+}
+
+func (n *ProxyTable) Value(row, col int) interface{} {
+	item := n.items[row]
+	switch col {
+	case 0:
+		return item.Index
+	case 1:
+		return item.Route
+	case 2:
+		return item.Target
+	case 3:
+		return item.Switches
+	}
+	panic("unexpected col")
+}
+
+func (n *ProxyTable) Checked(row int) bool {
+	return n.items[row].checked
+}
+
+func (n *ProxyTable) SetChecked(row int, checked bool) error {
+	n.items[row].checked = checked
+	return nil
+}
+
+func (m *ProxyTable) Sort(col int, order walk.SortOrder) error {
+	m.sortColumn, m.sortOrder = col, order
+	sort.SliceStable(m.items, func(i, j int) bool {
+		a, b := m.items[i], m.items[j]
+		c := func(ls bool) bool {
+			if m.sortOrder == walk.SortAscending {
+				return ls
+			}
+			return !ls
+		}
+		switch m.sortColumn {
+		case 0:
+			return c(a.Index < b.Index)
+		case 1:
+			return c(a.Route < b.Route)
+		case 2:
+			return c(a.Target < b.Target)
+		case 3:
+			return c(a.Switches < b.Switches)
+		}
+		panic("unreachable")
+	})
+	return m.SorterBase.Sort(col, order)
+}
+
+// ProxySwitchesFormat names the enabled switches of a proxy route
+func ProxySwitchesFormat(proxy ProxyInfo) string {
+	output := make([]string, 0)
+	for _, item := range []struct {
+		name string
+		flag bool
+	}{
+		{"strip", proxy.StripRoute},
+		{"host", proxy.KeepHost},
+		{"auth", proxy.AuthEnable},
+		{"insecure", proxy.Insecure},
+	} {
+		if item.flag {
+			output = append(output, item.name)
+		}
+	}
+	return strings.Join(output, ",")
+}
+
+var proxyTable *ProxyTable
+var proxyView *walk.TableView
+
+func ProxyTableInit(proxies []ProxyInfo) {
+	item := make([]*ProxyItem, 0)
+	for i, proxy := range proxies {
+		item = append(item, &ProxyItem{
+			Index:    i,
+			Route:    proxy.Route,
+			Target:   proxy.Target,
+			Switches: ProxySwitchesFormat(proxy),
+			proxy:    proxy,
+		})
+	}
+	proxyTable.items = item
+
+	proxyTable.PublishRowsReset()
+	proxyTable.Sort(proxyTable.sortColumn, proxyTable.sortOrder)
+}
+
+// ProxyTableAdd adds a proxy route or updates the one with the same route
+func ProxyTableAdd(proxy ProxyInfo) error {
+	proxyTable.Lock()
+	defer proxyTable.Unlock()
+
+	proxies := make([]ProxyInfo, 0)
+	var exist bool
+	for _, item := range ConfigGet().Proxies {
+		if item.Route == proxy.Route {
+			item = proxy
+			exist = true
+		}
+		proxies = append(proxies, item)
+	}
+	if !exist {
+		proxies = append(proxies, proxy)
+	}
+
+	err := ProxyInfoCheck(proxies, ConfigGet().Mounts)
+	if err != nil {
+		return err
+	}
+
+	ProxyTableInit(proxies)
+	return ProxiesSave(proxies)
+}
+
+func ProxyTableDelete() error {
+	proxyTable.Lock()
+	defer proxyTable.Unlock()
+
+	proxies := make([]ProxyInfo, 0)
+	for _, items := range proxyTable.items {
+		if !items.checked {
+			proxies = append(proxies, items.proxy)
+		}
+	}
+
+	if len(proxies) == len(proxyTable.items) {
+		return fmt.Errorf("please select some proxy to delete")
+	}
+
+	ProxyTableInit(proxies)
+	return ProxiesSave(proxies)
+}
+
+func ProxiesAction() {
+	var dlg *walk.Dialog
+	var addPB, deletePB, acceptPB *walk.PushButton
+	var routeLine, targetLine *walk.LineEdit
+	var headersText *walk.TextEdit
+	var timeoutNumber *walk.NumberEdit
+	var stripCheck, hostCheck, authCheck, insecureCheck *walk.CheckBox
+
+	proxyTable = new(ProxyTable)
+	ProxyTableInit(ConfigGet().Proxies)
+
+	_, err := Dialog{
+		AssignTo:      &dlg,
+		Title:         "Proxy Routes Edit",
+		Icon:          walk.IconInformation(),
+		DefaultButton: &acceptPB,
+		CancelButton:  &acceptPB,
+		Size:          Size{Width: 650, Height: 450},
+		MinSize:       Size{Width: 650, Height: 450},
+		Layout:        VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: Grid{Columns: 2, MarginsZero: true},
+				Children: []Widget{
+					Label{
+						Text: "Route: ",
+					},
+					LineEdit{
+						AssignTo:    &routeLine,
+						Text:        "",
+						ToolTipText: "The url prefix forwarded to the target, e.g. /api",
+					},
+					Label{
+						Text: "Target: ",
+					},
+					LineEdit{
+						AssignTo:    &targetLine,
+						Text:        "",
+						ToolTipText: "The upstream server, e.g. http://127.0.0.1:8080",
+					},
+					Label{
+						Text: "Headers: ",
+					},
+					TextEdit{
+						AssignTo:    &headersText,
+						MinSize:     Size{Height: 50},
+						Text:        "",
+						VScroll:     true,
+						ToolTipText: "One \"Name: value\" per line set on the forwarded requests, an empty value removes the header",
+					},
+					Label{
+						Text: "Timeout: ",
+					},
+					NumberEdit{
+						AssignTo:    &timeoutNumber,
+						Value:       float64(proxyTimeoutDefault),
+						ToolTipText: "Seconds to wait for the upstream response headers, 0 is the default of 30 seconds",
+						MaxValue:    3600,
+						MinValue:    0,
+					},
+					Label{
+						Text: "Switches: ",
+					},
+					Composite{
+						Layout: HBox{MarginsZero: true},
+						Children: []Widget{
+							CheckBox{
+								AssignTo:    &stripCheck,
+								Text:        "Strip Route",
+								ToolTipText: "Remove the route from the forwarded path",
+							},
+							CheckBox{
+								AssignTo:    &hostCheck,
+								Text:        "Keep Host",
+								ToolTipText: "Forward the host header of the client instead of the target host",
+							},
+							CheckBox{
+								AssignTo:    &authCheck,
+								Text:        "Auth",
+								ToolTipText: "Users of the users edit page must log in, the credentials are not forwarded",
+							},
+							CheckBox{
+								AssignTo:    &insecureCheck,
+								Text:        "Insecure",
+								ToolTipText: "Skip the certificate verification of a https target",
+							},
+							HSpacer{},
+						},
+					},
+				},
+			},
+			Label{
+				Text: "ProxyList: ",
+			},
+			TableView{
+				AssignTo:         &proxyView,
+				AlternatingRowBG: true,
+				ColumnsOrderable: true,
+				CheckBoxes:       true,
+				Columns: []TableViewColumn{
+					{Title: "#", Width: 60},
+					{Title: "Route", Width: 120},
+					{Title: "Target", Width: 250},
+					{Title: "Switches", Width: 180},
+				},
+				StyleCell: func(style *walk.CellStyle) {
+					if style.Row()%2 == 0 {
+						style.BackgroundColor = walk.RGB(248, 248, 255)
+					} else {
+						style.BackgroundColor = walk.RGB(220, 220, 220)
+					}
+				},
+				Model: proxyTable,
+				OnCurrentIndexChanged: func() {
+					index := proxyView.CurrentIndex()
+					if 0 <= index && index < len(proxyTable.items) {
+						proxy := proxyTable.items[index].proxy
+						routeLine.SetText(proxy.Route)
+						targetLine.SetText(proxy.Target)
+						headersText.SetText(ProxyHeadersFormat(proxy.Headers))
+						timeoutNumber.SetValue(float64(proxy.Timeout))
+						stripCheck.SetChecked(proxy.StripRoute)
+						hostCheck.SetChecked(proxy.KeepHost)
+						authCheck.SetChecked(proxy.AuthEnable)
+						insecureCheck.SetChecked(proxy.Insecure)
+					}
+				},
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &addPB,
+						Text:     "Add",
+						OnClicked: func() {
+							headers, err := ProxyHeadersParse(headersText.Text())
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							proxy := ProxyInfo{
+								Route:      strings.TrimSuffix(strings.TrimSpace(routeLine.Text()), "/"),
+								Target:     strings.TrimSpace(targetLine.Text()),
+								StripRoute: stripCheck.Checked(),
+								KeepHost:   hostCheck.Checked(),
+								AuthEnable: authCheck.Checked(),
+								Insecure:   insecureCheck.Checked(),
+								Headers:    headers,
+								Timeout:    int64(timeoutNumber.Value()),
+							}
+							err = ProxyTableAdd(proxy)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							routeLine.SetText("")
+							targetLine.SetText("")
+							headersText.SetText("")
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &deletePB,
+						Text:     "Delete",
+						OnClicked: func() {
+							err := ProxyTableDelete()
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "Cancel",
+						OnClicked: func() {
+							dlg.Accept()
+						},
+					},
+					HSpacer{},
+				},
+			},
+		},
+	}.Run(mainWindow)
+
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	// seconds to wait for the connection and the response headers of the
+	// upstream server when the route does not set its own timeout
+	proxyTimeoutDefault = 30
+)
+
+// ProxyHeadersParse reads one "Name: value" per line, an empty value
+// removes the header from the forwarded request.
+func ProxyHeadersParse(value string) ([]string, error) {
+	output := make([]string, 0)
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, header, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("proxy header %s must look like Name: value", line)
+		}
+		output = append(output, fmt.Sprintf("%s: %s", http.CanonicalHeaderKey(name), strings.TrimSpace(header)))
+	}
+	return output, nil
+}
+
+func ProxyHeadersFormat(headers []string) string {
+	return strings.Join(headers, "\r\n")
+}
+
+func ProxyInfoCheck(proxies []ProxyInfo, mounts []MountInfo) error {
+	routes := make([]string, 0, len(proxies))
+	for _, proxy := range proxies {
+		if err := RouteCheck(proxy.Route); err != nil {
+			return err
+		}
+		if permissionHas(routes, proxy.Route) {
+			return fmt.Errorf("proxy route %s is used twice", proxy.Route)
+		}
+		for _, mount := range mounts {
+			if mount.Route == proxy.Route {
+				return fmt.Errorf("proxy route %s is used by a mount", proxy.Route)
+			}
+		}
+		routes = append(routes, proxy.Route)
+
+		target, err := url.Parse(proxy.Target)
+		if err != nil {
+			return fmt.Errorf("proxy %s target %s, %s", proxy.Route, proxy.Target, err.Error())
+		}
+		if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("proxy %s target %s must look like http://127.0.0.1:8080", proxy.Route, proxy.Target)
+		}
+		if proxy.Timeout < 0 {
+			return fmt.Errorf("proxy %s timeout must not be negative", proxy.Route)
+		}
+		if _, err := ProxyHeadersParse(strings.Join(proxy.Headers, "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proxyRoute forwards the requests under its route to the target, upgraded
+// connections like websockets are passed through by the reverse proxy.
+type proxyRoute struct {
+	info      ProxyInfo
+	target    *url.URL
+	auth      *fileHandler
+	proxy     *httputil.ReverseProxy
+	transport *http.Transport
+}
+
+func (f *fileHandler) proxyNew(info ProxyInfo) (*proxyRoute, error) {
+	target, err := url.Parse(info.Target)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(info.Timeout) * time.Second
+	if info.Timeout == 0 {
+		timeout = proxyTimeoutDefault * time.Second
+	}
+
+	p := &proxyRoute{
+		info:   info,
+		target: target,
+		// the auth handler of the route checks the users like a mount does
+		auth: f.mountNew(MountInfo{Route: info.Route, AuthEnable: info.AuthEnable}),
+		transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   timeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:       &tls.Config{InsecureSkipVerify: info.Insecure},
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			IdleConnTimeout:       90 * time.Second,
+			ForceAttemptHTTP2:     true,
+		},
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite:      p.rewrite,
+		Transport:    p.transport,
+		ErrorHandler: p.serveError,
+	}
+	return p, nil
+}
+
+// proxyGet returns the proxy with the longest route holding the url path
+func (f *fileHandler) proxyGet(urlPath string) *proxyRoute {
+	urlPath = path.Clean("/" + urlPath)
+	for _, proxy := range f.proxies {
+		if urlPath == proxy.info.Route || strings.HasPrefix(urlPath, proxy.info.Route+"/") {
+			return proxy
+		}
+	}
+	return nil
+}
+
+func (f *fileHandler) proxyAdd(info ProxyInfo) error {
+	proxy, err := f.proxyNew(info)
+	if err != nil {
+		return err
+	}
+	f.proxies = append(f.proxies, proxy)
+	// the longest route is matched first
+	sort.SliceStable(f.proxies, func(i, j int) bool {
+		return len(f.proxies[i].info.Route) > len(f.proxies[j].info.Route)
+	})
+	return nil
+}
+
+func (p *proxyRoute) rewrite(r *httputil.ProxyRequest) {
+	if p.info.StripRoute {
+		r.Out.URL.Path = strings.TrimPrefix(r.In.URL.Path, p.info.Route)
+		if r.In.URL.RawPath != "" {
+			r.Out.URL.RawPath = strings.TrimPrefix(r.In.URL.RawPath, (&url.URL{Path: p.info.Route}).EscapedPath())
+		}
+	}
+	r.SetURL(p.target)
+	r.SetXForwarded()
+	if p.info.KeepHost {
+		r.Out.Host = r.In.Host
+	}
+
+	// the credentials of the file server stay with it
+	if p.info.AuthEnable {
+		r.Out.Header.Del("Authorization")
+	}
+	cookies := r.Out.Cookies()
+	r.Out.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != sessionCookieName {
+			r.Out.AddCookie(cookie)
+		}
+	}
+
+	for _, header := range p.info.Headers {
+		name, value, _ := strings.Cut(header, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if value == "" {
+			r.Out.Header.Del(name)
+		} else {
+			r.Out.Header.Set(name, value)
+		}
+	}
+}
+
+// serveError answers 504 when the upstream server timed out, 502 otherwise
+func (p *proxyRoute) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	logs.Error("http server proxy %s %s to %s fail, %s", r.Method, r.URL.Path, p.info.Target, err.Error())
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+		return
+	}
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+func (p *proxyRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := p.auth.AuthHandler(w, r)
+	if !ok {
+		return
+	}
+	if user != nil {
+		r = authUserSet(r, user)
+	}
+	if !p.auth.permit(r, path.Clean("/"+r.URL.Path), PermRead) {
+		_ = p.auth.serveStatus(w, r, http.StatusForbidden)
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *proxyRoute) Close() {
+	p.transport.CloseIdleConnections()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proxySeen is what the upstream server of the tests received
+type proxySeen struct {
+	Path    string
+	RawPath string
+	Query   string
+	Host    string
+	Header  http.Header
+}
+
+func proxyUpstream(t *testing.T) *httptest.Server {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow") {
+			time.Sleep(2 * time.Second)
+		}
+		json.NewEncoder(w).Encode(proxySeen{
+			Path:    r.URL.Path,
+			RawPath: r.URL.RawPath,
+			Query:   r.URL.RawQuery,
+			Host:    r.Host,
+			Header:  r.Header,
+		})
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestServeProxyRewrite(t *testing.T) {
+	upstream := proxyUpstream(t)
+	f := permissionTestHandler(t)
+	routes := []ProxyInfo{
+		{Route: "/api", Target: upstream.URL + "/base", StripRoute: true, AuthEnable: true,
+			Headers: []string{"X-Added: yes", "X-Remove: "}},
+		{Route: "/app", Target: upstream.URL, KeepHost: true},
+		{Route: "/app/slow", Target: upstream.URL, Timeout: 1},
+	}
+	for _, info := range routes {
+		if err := f.proxyAdd(info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, proxy := range f.proxies {
+			proxy.Close()
+		}
+	}()
+	intern := testBasicAuth("intern", "secret")
+	intern["Cookie"] = sessionCookieName + "=session; theme=dark"
+	intern["X-Remove"] = "client value"
+
+	seen := func(target string, header map[string]string) proxySeen {
+		t.Helper()
+		w := testServe(t, f, http.MethodGet, target, "", header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %q", target, w.Code, w.Body.String())
+		}
+		var output proxySeen
+		if err := json.Unmarshal(w.Body.Bytes(), &output); err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+
+	got := seen("http://files.test/api/v1/items?x=1", intern)
+	if got.Path != "/base/v1/items" || got.Query != "x=1" {
+		t.Errorf("stripped route = %s?%s, want /base/v1/items?x=1", got.Path, got.Query)
+	}
+	if got.Host != strings.TrimPrefix(upstream.URL, "http://") {
+		t.Errorf("host = %s, want the target host", got.Host)
+	}
+	if got.Header.Get("Authorization") != "" {
+		t.Error("the credentials of the file server were forwarded")
+	}
+	if cookie := got.Header.Get("Cookie"); cookie != "theme=dark" {
+		t.Errorf("cookie = %q, want only theme=dark", cookie)
+	}
+	if got.Header.Get("X-Added") != "yes" || got.Header.Get("X-Remove") != "" {
+		t.Errorf("headers X-Added %q, X-Remove %q", got.Header.Get("X-Added"), got.Header.Get("X-Remove"))
+	}
+	if got.Header.Get("X-Forwarded-Host") != "files.test" || got.Header.Get("X-Forwarded-For") == "" {
+		t.Errorf("forwarded headers = %v", got.Header)
+	}
+
+	if got := seen("http://files.test/api/a%2Fb", intern); got.Path != "/base/a/b" || got.RawPath != "/base/a%2Fb" {
+		t.Errorf("escaped path = %s (%s), want /base/a%%2Fb", got.Path, got.RawPath)
+	}
+	got = seen("http://files.test/app/x.js", nil)
+	if got.Path != "/app/x.js" || got.Host != "files.test" {
+		t.Errorf("kept route and host = %s %s", got.Host, got.Path)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		header map[string]string
+		status int
+	}{
+		{"auth of the route", "/api/v1", nil, http.StatusUnauthorized},
+		{"read permission of the route", "/api/v1", testBasicAuth("bob", "hunter2"), http.StatusForbidden},
+		{"sibling prefix is a file", "/apix", intern, http.StatusNotFound},
+		{"upstream timeout", "/app/slow", nil, http.StatusGatewayTimeout},
+	}
+	for _, test := range tests {
+		if w := testServe(t, f, http.MethodGet, test.target, "", test.header); w.Code != test.status {
+			t.Errorf("%s: GET %s = %d, want %d", test.name, test.target, w.Code, test.status)
+		}
+	}
+
+	upstream.Close()
+	if w := testServe(t, f, http.MethodGet, "/app/x.js", "", nil); w.Code != http.StatusBadGateway {
+		t.Errorf("upstream down = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+}
+
+func TestProxyInfoCheck(t *testing.T) {
+	headers, err := ProxyHeadersParse("x-api-key: abc\r\n\r\nX-Remove:")
+	if err != nil || ProxyHeadersFormat(headers) != "X-Api-Key: abc\r\nX-Remove: " {
+		t.Errorf("ProxyHeadersParse = %q, %v", headers, err)
+	}
+	if _, err := ProxyHeadersParse("no colon"); err == nil {
+		t.Error("ProxyHeadersParse accepted a line without a colon")
+	}
+
+	mounts := []MountInfo{{Route: "/media"}}
+	tests := []struct {
+		proxies []ProxyInfo
+		valid   bool
+	}{
+		{[]ProxyInfo{{Route: "/api", Target: "http://127.0.0.1:8080"}}, true},
+		{[]ProxyInfo{{Route: "/api", Target: "https://backend.test/base"}}, true},
+		{[]ProxyInfo{{Route: "/", Target: "http://127.0.0.1:8080"}}, false},
+		{[]ProxyInfo{{Route: "/media", Target: "http://127.0.0.1:8080"}}, false},
+		{[]ProxyInfo{{Route: "/api", Target: "ftp://127.0.0.1"}}, false},
+		{[]ProxyInfo{{Route: "/api", Target: "127.0.0.1:8080"}}, false},
+		{[]ProxyInfo{{Route: "/api", Target: "http://127.0.0.1:8080", Timeout: -1}}, false},
+		{[]ProxyInfo{{Route: "/api", Target: "http://a.test"}, {Route: "/api", Target: "http://b.test"}}, false},
+	}
+	for _, test := range tests {
+		if err := ProxyInfoCheck(test.proxies, mounts); (err == nil) != test.valid {
+			t.Errorf("ProxyInfoCheck(%+v) = %v, want valid %v", test.proxies, err, test.valid)
+		}
+	}
+}
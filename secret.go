@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const secretLength = 32
+
+var secretLock sync.Mutex
+
+// SecretGet returns the random key stored as name in the config dir, it is
+// created on first use so signed cookies and links survive a restart. A key
+// that can not be read is an error, replacing it would sign out everyone.
+func SecretGet(name string) ([]byte, error) {
+	secretLock.Lock()
+	defer secretLock.Unlock()
+
+	filePath := fmt.Sprintf("%s%c%s", ConfigDirGet(), os.PathSeparator, name)
+	key, err := os.ReadFile(filePath)
+	if err == nil {
+		if len(key) != secretLength {
+			return nil, fmt.Errorf("secret %s has %d bytes, want %d", filePath, len(key), secretLength)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, secretLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(filePath, key, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -3,10 +3,9 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
 	"math"
 	"net"
 	"net/http"
@@ -21,6 +20,8 @@ import (
 	"time"
 
 	"github.com/astaxie/beego/logs"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 const (
@@ -29,6 +30,9 @@ const (
 	zipContentType = "application/zip"
 
 	osPathSeparator = string(filepath.Separator)
+
+	// one year, browsers keep using https for the host in that time
+	hstsMaxAge = 365 * 24 * 3600
 )
 
 const directoryListingTemplateText = `
@@ -40,7 +44,33 @@ const directoryListingTemplateText = `
 </head>
 <body>
 <h1>{{ .Title }}</h1>
-{{ if or .Files .AllowUpload }}
+{{ if .Logout }}
+<p>{{ .User }} <a style="display:inline" href="{{ .Logout }}">Logout</a></p>
+{{ end }}
+{{ if .Uploads }}
+<table>
+	<thead>
+		<th class=text>Uploaded</th>
+		<th class=number>Size (bytes)</th>
+		<th class=text>Result</th>
+	</thead>
+	<tbody>
+	{{- range .Uploads }}
+	<tr>
+		<td class=text>{{ .Name }}</td>
+		<td class=number>{{ .Size }}</td>
+		<td class=text>
+		{{- if .Error }}{{ .Error }}
+		{{- else if eq .Conflict "renamed" }}Renamed to {{ .SavedAs }}
+		{{- else if eq .Conflict "overwritten" }}Overwritten
+		{{- else }}OK{{ end -}}
+		</td>
+	</tr>
+	{{- end }}
+	</tbody>
+</table>
+{{ end }}
+{{ if or .Files .AllowUpload .AllowShare }}
 <table>
 	<thead>
 		<th></th>
@@ -62,7 +92,10 @@ const directoryListingTemplateText = `
 	</tr>
 	{{- end }}
 	{{- if .AllowUpload }}
-	<tr><td colspan=3><form method="post" enctype="multipart/form-data"><input required name="file" type="file"/><input value="Upload" type="submit"/></form></td></tr>
+	<tr><td colspan=3><form method="post" enctype="multipart/form-data"><input required multiple name="file" type="file"/><input value="Upload" type="submit"/></form></td></tr>
+	{{- end }}
+	{{- if .AllowShare }}
+	<tr><td colspan=3><form method="post" action="{{ .ShareURL }}"><input type="hidden" name="back" value="{{ .Path }}"/><select name="path"><option value="{{ .Path }}">{{ .Title }}</option>{{ range .Files }}<option value="{{ .URL.Path }}">{{ .Name }}</option>{{ end }}</select> for <input required name="hours" type="number" min="1" value="24" style="width:5em"/> hours, <input required name="limit" type="number" min="0" value="0" style="width:5em" title="0 is unlimited"/> downloads <input value="Share" type="submit"/></form></td></tr>
 	{{- end }}
 	</tbody>
 </table>
@@ -105,10 +138,16 @@ type directoryListingFileData struct {
 
 type directoryListingData struct {
 	Title       string
+	Path        string
 	ZipURL      *url.URL
+	ShareURL    string
 	Files       []directoryListingFileData
 	AllowUpload bool
 	AllowZip    bool
+	AllowShare  bool
+	Uploads     []uploadResult
+	User        string
+	Logout      string
 }
 
 var (
@@ -117,18 +156,49 @@ var (
 
 type fileHandler struct {
 	route string
+	host  string
 	path  string
 
 	allowZip    bool
 	allowUpload bool
 	allowDelete bool
 	allowAuth   bool
-
-	userList []UserInfo
+	allowWebdav bool
+	allowHttps  bool
+	allowHsts   bool
+
+	uploadConflict string
+
+	locks     *davLockSystem
+	uploads   *tusUploads
+	userList  []UserInfo
+	passwords *passwordCache
+	lockout   *authLockout
+	login     *sessionSigner
+	shares    *shareLinks
+	acme      *acmeManager
+	certFiles *certFileWatcher
+	sni       *sniCertificates
+	monitor   *certMonitor
+	http3     *http3Server
+
+	allowStatus bool
+
+	allowSite     bool
+	siteCleanURLs bool
+	siteFallback  string
 
 	timeout int
 	address string
 	server  *http.Server
+	plain   *http.Server
+
+	failures []string
+
+	root    *fileHandler
+	mounts  []*fileHandler
+	hosts   map[string]*fileHandler
+	proxies []*proxyRoute
 
 	flowbytes int64
 	requests  int64
@@ -146,27 +216,64 @@ func (f *fileHandler) serveStatus(w http.ResponseWriter, r *http.Request, status
 	return nil
 }
 
+// serveError answers the request with the status matching the error
+// returned by one of the serve functions.
+func (f *fileHandler) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == nil:
+	case os.IsNotExist(err):
+		_ = f.serveStatus(w, r, http.StatusNotFound)
+	case os.IsPermission(err):
+		_ = f.serveStatus(w, r, http.StatusForbidden)
+	case errors.Is(err, errUploadConflict):
+		_ = f.serveStatus(w, r, http.StatusConflict)
+	case errors.Is(err, errUploadChecksum), errors.Is(err, errUploadRequest):
+		_ = f.serveStatus(w, r, http.StatusBadRequest)
+	default:
+		logs.Error("http server %s %s fail, %s", r.Method, r.URL.Path, err.Error())
+		_ = f.serveStatus(w, r, http.StatusInternalServerError)
+	}
+}
+
 func (f *fileHandler) serveZip(w http.ResponseWriter, r *http.Request, osPath string) error {
 	w.Header().Set("Content-Type", zipContentType)
 	name := filepath.Base(osPath) + ".zip"
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename=%q`, name))
-	return FileZip(w, osPath)
+	return FileZip(w, osPath, f.uploadStageGet())
 }
 
-func (f *fileHandler) serveDir(w http.ResponseWriter, r *http.Request, osPath string) error {
+func (f *fileHandler) serveDir(w http.ResponseWriter, r *http.Request, osPath string, uploads []uploadResult) error {
 	d, err := os.Open(osPath)
 	if err != nil {
 		return err
 	}
 	files, err := d.Readdir(-1)
+	d.Close()
 	if err != nil {
 		return err
 	}
+	if osPath == f.path {
+		files = uploadStageHide(files)
+	}
 	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	urlPath := path.Clean("/" + r.URL.Path)
+	var user, logout string
+	if authUser := authUserGet(r); authUser != nil && f.login != nil && shareLinkGet(r) == nil {
+		user, logout = authUser.UserName, logoutPath
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	return directoryListingTemplate.Execute(w, directoryListingData{
-		AllowUpload: f.allowUpload,
-		AllowZip:    f.allowZip,
+	if status := uploadStatus(uploads); status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	data := directoryListingData{
+		AllowUpload: f.permit(r, urlPath, PermUpload),
+		AllowZip:    f.permit(r, urlPath, PermZip),
+		AllowShare:  f.shares != nil && f.allowAuth && f.permit(r, urlPath, PermShare),
+		Path:        urlPath,
+		ShareURL:    sharePath,
+		Uploads:     uploads,
+		User:        user,
+		Logout:      logout,
 		Title: func() string {
 			relPath, _ := filepath.Rel(f.path, osPath)
 			urlPath := filepath.Join(filepath.Base(f.path), relPath)
@@ -202,100 +309,209 @@ func (f *fileHandler) serveDir(w http.ResponseWriter, r *http.Request, osPath st
 			}
 			return out
 		}(),
-	})
+	}
+	if f.root == f && urlPath == "/" {
+		data.Files = append(f.mountFiles(r), data.Files...)
+	}
+	return directoryListingTemplate.Execute(w, data)
 }
 
-func (f *fileHandler) serveUploadTo(w http.ResponseWriter, r *http.Request, osPath string) error {
-	if err := r.ParseForm(); err != nil {
-		return err
+// authVerify checks the user name and password of a login, it returns the
+// remaining lock time instead when the client or the user is locked out.
+func (f *fileHandler) authVerify(r *http.Request, username, password string) (*UserInfo, time.Duration) {
+	keys := lockoutKeys(r, username)
+	if remain := f.lockout.Locked(keys); remain > 0 {
+		return nil, remain
 	}
-	in, h, err := r.FormFile("file")
-	if err == http.ErrMissingFile {
-		w.Header().Set("Location", r.URL.String())
-		w.WriteHeader(303)
-	}
-	if err != nil {
-		return err
+
+	var authUser *UserInfo
+	for i, user := range f.userList {
+		if user.UserName == username {
+			authUser = &f.userList[i]
+			break
+		}
 	}
-	outPath := filepath.Join(osPath, filepath.Base(h.Filename))
-	out, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+
+	// users without a password only log in by their client cert
+	if authUser == nil || authUser.Password == "" {
+		PasswordVerify(passwordDummy, password)
+		authUser = nil
+	} else if !f.passwords.Verify(authUser.UserName, authUser.Password, password) {
+		authUser = nil
 	}
-	defer out.Close()
 
-	if _, err := io.Copy(out, in); err != nil {
-		return err
+	if authUser == nil {
+		f.lockout.Fail(keys)
+		logs.Warning("http server %s auth failed for user [%s]", r.RemoteAddr, username)
+		return nil, 0
 	}
-	w.Header().Set("Location", r.URL.String())
-	w.WriteHeader(303)
-	return nil
+
+	f.lockout.Success(keys)
+	return authUser, 0
 }
 
-func (f *fileHandler) AuthHandler(w http.ResponseWriter, r *http.Request) bool {
+// AuthHandler checks the client cert, the session cookie or the basic auth of
+// the request and returns the matched user, the user is nil when the
+// authentication is disabled.
+func (f *fileHandler) AuthHandler(w http.ResponseWriter, r *http.Request) (*UserInfo, bool) {
 	if !f.allowAuth {
-		return true
+		return nil, true
 	}
 
-	auth := r.Header.Get("Authorization")
-	if auth == "" {
-		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		http.Error(w, "Authentication failed, missing username and password!", http.StatusUnauthorized)
-		return false
+	if user := f.certUser(r); user != nil {
+		logs.Info("http server [%s] auth passed by client cert", user.UserName)
+		return user, true
 	}
 
-	authInfo, err := base64.StdEncoding.DecodeString(auth[6:])
-	if err != nil {
-		http.Error(w, "Authentication failed, missing username and password!", http.StatusUnauthorized)
-		return false
+	if user := f.sessionUser(r); user != nil {
+		return user, true
 	}
 
-	var authPass bool
-	var authUser UserInfo
-
-	logs.Info("http server auth info [%s]", string(authInfo))
-
-	for _, user := range f.userList {
-		userInfo := fmt.Sprintf("%s:%s", user.UserName, user.Password)
-		logs.Info("http server user [%s]", userInfo)
-
-		if string(authInfo) == userInfo {
-			authPass = true
-			authUser = user
-			break
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		if f.login != nil && loginRedirect(r) {
+			http.Redirect(w, r, loginPath+"?"+url.Values{"next": {r.URL.RequestURI()}}.Encode(), http.StatusSeeOther)
+			return nil, false
 		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		http.Error(w, "Authentication failed, missing username and password!", http.StatusUnauthorized)
+		return nil, false
 	}
 
-	if !authPass {
+	authUser, remain := f.authVerify(r, username, password)
+	if remain > 0 {
+		lockoutServe(w, remain)
+		return nil, false
+	}
+	if authUser == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 		http.Error(w, "Authentication failed, user or password error!", http.StatusUnauthorized)
-		return false
+		return nil, false
 	}
 
 	logs.Info("http server [%s] auth passed", authUser.UserName)
-	return true
+	return authUser, true
+}
+
+// osPathGet maps the url path of a request to the file under the server dir
+func (f *fileHandler) osPathGet(urlPath string) string {
+	osPath := strings.ReplaceAll(f.mountPath(urlPath), "/", osPathSeparator)
+	osPath = filepath.Clean(osPath)
+	return filepath.Join(f.path, osPath)
 }
 
 // ServeHTTP is http.Handler.ServeHTTP
 func (f *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	logs.Info("http server request [%s] %s %s %s", f.path, r.RemoteAddr, r.Method, r.URL.String())
+	host := f.hostGet(r)
+
+	logs.Info("http server request [%s] %s %s %s %s", host.mountGet(r.URL.Path).path, r.RemoteAddr, clientCertName(r), r.Method, shareRedact(r.URL))
 
 	atomic.AddInt64(&f.requests, 1)
 	StatusRequestUpdate(f.requests)
 
-	if !f.AuthHandler(w, r) {
+	if r.TLS != nil && f.allowHsts {
+		w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", hstsMaxAge))
+	}
+	if r.TLS != nil && f.http3 != nil && r.ProtoMajor < 3 {
+		f.http3.AltSvc(w.Header())
+	}
+
+	if f.login != nil {
+		switch path.Clean("/" + r.URL.Path) {
+		case loginPath:
+			f.serveError(w, r, f.serveLogin(w, r))
+			return
+		case logoutPath:
+			f.serveError(w, r, f.serveLogout(w, r))
+			return
+		}
+	}
+
+	// the proxy routes come before the files of the hosts and mounts
+	if proxy := f.proxyGet(r.URL.Path); proxy != nil {
+		proxy.ServeHTTP(w, r)
 		return
 	}
 
-	urlPath := r.URL.Path
-	if !strings.HasPrefix(urlPath, "/") {
-		urlPath = "/" + urlPath
+	// a share link is created by the mount of the shared path
+	routePath := path.Clean("/" + r.URL.Path)
+	if routePath == sharePath && r.Method == http.MethodPost {
+		routePath = path.Clean("/" + r.PostFormValue("path"))
 	}
-	urlPath = strings.TrimPrefix(urlPath, f.route)
-	urlPath = strings.TrimPrefix(urlPath, "/"+f.route)
+	host.mountGet(routePath).serveMount(w, r)
+}
 
-	osPath := strings.ReplaceAll(urlPath, "/", osPathSeparator)
-	osPath = filepath.Clean(osPath)
-	osPath = filepath.Join(f.path, osPath)
+// serveMount serves a request on the folder of the mount
+func (f *fileHandler) serveMount(w http.ResponseWriter, r *http.Request) {
+	link, ok := f.shareAuth(w, r)
+	if !ok {
+		return
+	}
+
+	var user *UserInfo
+	if link != nil {
+		user = link.User()
+		r = shareLinkSet(r, link)
+	} else {
+		user, ok = f.AuthHandler(w, r)
+		if !ok {
+			return
+		}
+	}
+	if user != nil {
+		r = authUserSet(r, user)
+	}
+
+	urlPath := path.Clean("/" + r.URL.Path)
+	osPath := f.osPathGet(r.URL.Path)
+
+	if f.allowStatus && urlPath == statusPath {
+		if !f.permit(r, urlPath, PermAdmin) {
+			_ = f.serveStatus(w, r, http.StatusForbidden)
+			return
+		}
+		f.serveError(w, r, f.serveServerStatus(w, r))
+		return
+	}
+
+	if f.shares != nil && urlPath == sharePath {
+		f.serveError(w, r, f.serveShare(w, r))
+		return
+	}
+
+	if f.path == "" {
+		if urlPath != "/" {
+			_ = f.serveStatus(w, r, http.StatusNotFound)
+			return
+		}
+		f.serveError(w, r, f.serveMounts(w, r))
+		return
+	}
+
+	// a resumable upload on the stage path is checked against its target
+	// folder and creator by serveTus
+	tusStage := f.allowUpload && tusRequest(r) && uploadStagePath(urlPath)
+	if !tusStage && !f.permit(r, urlPath, requestPermission(r)) {
+		_ = f.serveStatus(w, r, http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case f.allowUpload && (tusRequest(r) || r.Method == http.MethodOptions):
+		f.serveError(w, r, f.serveTus(w, r, osPath))
+		return
+	case uploadStagePath(f.mountPath(r.URL.Path)):
+		_ = f.serveStatus(w, r, http.StatusNotFound)
+		return
+	case f.allowWebdav && davMethods[r.Method]:
+		f.serveError(w, r, f.serveWebdav(w, r, urlPath, osPath))
+		return
+	}
+
+	if f.allowSite && shareLinkGet(r) == nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		r.URL.Query().Get(zipKey) == "" && f.serveSite(w, r, urlPath, osPath) {
+		return
+	}
 
 	info, err := os.Stat(osPath)
 	switch {
@@ -305,27 +521,26 @@ func (f *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		_ = f.serveStatus(w, r, http.StatusForbidden)
 	case err != nil:
 		_ = f.serveStatus(w, r, http.StatusInternalServerError)
-	case !f.allowDelete && r.Method == http.MethodDelete:
-		_ = f.serveStatus(w, r, http.StatusForbidden)
-	case !f.allowUpload && r.Method == http.MethodPost:
-		_ = f.serveStatus(w, r, http.StatusForbidden)
-	case f.allowZip && r.URL.Query().Get(zipKey) != "":
-		err := f.serveZip(w, r, osPath)
-		if err != nil {
-			_ = f.serveStatus(w, r, http.StatusInternalServerError)
+	case !info.IsDir() && !f.shareDownload(r):
+		_ = f.serveStatus(w, r, http.StatusGone)
+	case f.permit(r, urlPath, PermZip) && r.URL.Query().Get(zipKey) != "":
+		if !f.shareDownload(r) {
+			_ = f.serveStatus(w, r, http.StatusGone)
+			return
 		}
-	case f.allowUpload && info.IsDir() && r.Method == http.MethodPost:
-		err := f.serveUploadTo(w, r, osPath)
+		err := f.serveZip(w, r, osPath)
 		if err != nil {
 			_ = f.serveStatus(w, r, http.StatusInternalServerError)
 		}
-	case f.allowDelete && !info.IsDir() && r.Method == http.MethodDelete:
+	case info.IsDir() && r.Method == http.MethodPost:
+		f.serveError(w, r, f.serveUploadTo(w, r, osPath))
+	case !info.IsDir() && r.Method == http.MethodDelete:
 		err := os.Remove(osPath)
 		if err != nil {
 			_ = f.serveStatus(w, r, http.StatusInternalServerError)
 		}
 	case info.IsDir():
-		err := f.serveDir(w, r, osPath)
+		err := f.serveDir(w, r, osPath, nil)
 		if err != nil {
 			_ = f.serveStatus(w, r, http.StatusInternalServerError)
 		}
@@ -337,88 +552,434 @@ func (f *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (f *fileHandler) Shutdown() error {
 	context, cencel := context.WithTimeout(context.Background(), 5*time.Second)
 	err := f.server.Shutdown(context)
-	cencel()
 	if err != nil {
 		logs.Error("http file server ready to shut down fail, %s", err.Error())
 	}
+	if f.plain != nil {
+		err = f.plain.Shutdown(context)
+		if err != nil {
+			logs.Error("http file server ready to shut down the http listener fail, %s", err.Error())
+		}
+	}
+	cencel()
+	if f.http3 != nil {
+		f.http3.Close()
+	}
+	for _, proxy := range f.proxies {
+		proxy.Close()
+	}
+	if f.acme != nil {
+		f.acme.Close()
+	}
+	if f.certFiles != nil {
+		f.certFiles.Close()
+	}
+	if f.sni != nil {
+		f.sni.Close()
+	}
+	if f.monitor != nil {
+		f.monitor.Close()
+	}
 	f.Wait()
 	return nil
 }
 
+// ListenFailures reports the bind addresses the server could not listen
+// on, the others are served.
+func (f *fileHandler) ListenFailures() []string {
+	return f.failures
+}
+
+// certificate returns the certificate chain currently served, nil for http
+func (f *fileHandler) certificate() *tls.Certificate {
+	switch {
+	case f.acme != nil:
+		return f.acme.Certificate()
+	case f.certFiles != nil:
+		return f.certFiles.Certificate()
+	case f.server != nil && f.server.TLSConfig != nil && len(f.server.TLSConfig.Certificates) > 0:
+		return &f.server.TLSConfig.Certificates[0]
+	}
+	return nil
+}
+
+// httpsRedirect sends the request to the same url on the https port
+func httpsRedirect(w http.ResponseWriter, r *http.Request, httpsPort int64) {
+	host := r.Host
+	if name, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = name
+	}
+	host = strings.Trim(host, "[]")
+	if httpsPort != 443 {
+		host = net.JoinHostPort(host, fmt.Sprintf("%d", httpsPort))
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+}
+
+// h2cHandler accepts http/2 on a plain http listener when enabled, h2c only
+// speaks to clients with prior knowledge of it.
+func h2cHandler(cfg *Config, handler http.Handler) http.Handler {
+	if !cfg.H2cEnable {
+		return handler
+	}
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// plainHandler serves the http listener kept beside the https one, the
+// acme http challenge is answered here when both share the port.
+type plainHandler struct {
+	file      *fileHandler
+	httpsPort int64
+	redirect  bool
+}
+
+func (p *plainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.file.acme != nil && strings.HasPrefix(r.URL.Path, acmeHttpPathPrefix) {
+		p.file.acme.ServeHTTP(w, r)
+		return
+	}
+	if !p.redirect {
+		p.file.ServeHTTP(w, r)
+		return
+	}
+	httpsRedirect(w, r, p.httpsPort)
+}
+
+// listenAddress joins the listen address and port, ipv6 needs brackets
+func listenAddress(addr string, port int64) string {
+	if strings.Contains(addr, ":") {
+		return fmt.Sprintf("[%s]:%d", addr, port)
+	}
+	return fmt.Sprintf("%s:%d", addr, port)
+}
+
 func CreateHttpServer(cfg *Config) (*fileHandler, error) {
 
-	stat, err := os.Stat(cfg.ServerDir)
+	// the server dir may stay empty when folders are mounted, the root
+	// lists the mounts then
+	if cfg.ServerDir != "" || len(cfg.Mounts) == 0 {
+		stat, err := os.Stat(cfg.ServerDir)
+		if err != nil {
+			logs.Error("open server dir %s failed, %s", cfg.ServerDir, err.Error())
+			return nil, err
+		}
+
+		if !stat.IsDir() {
+			return nil, fmt.Errorf("server dir %s is not folder", cfg.ServerDir)
+		}
+	}
+
+	err := MountInfoCheck(cfg.Mounts)
 	if err != nil {
-		logs.Error("open server dir %s failed, %s", cfg.ServerDir, err.Error())
+		logs.Error("check mounted folders failed, %s", err.Error())
 		return nil, err
 	}
 
-	if !stat.IsDir() {
-		return nil, fmt.Errorf("server dir %s is not folder", cfg.ServerDir)
+	err = VirtualHostCheck(cfg.Hosts)
+	if err != nil {
+		logs.Error("check virtual hosts failed, %s", err.Error())
+		return nil, err
 	}
 
-	var address string
-	if strings.Contains(cfg.ListenAddr, ":") {
-		address = fmt.Sprintf("[%s]:%d", cfg.ListenAddr, cfg.ListenPort)
-	} else {
-		address = fmt.Sprintf("%s:%d", cfg.ListenAddr, cfg.ListenPort)
+	err = ProxyInfoCheck(cfg.Proxies, cfg.Mounts)
+	if err != nil {
+		logs.Error("check proxy routes failed, %s", err.Error())
+		return nil, err
 	}
 
-	listen, err := net.Listen("tcp", address)
+	addrs := ListenAddresses(cfg)
+
+	listens, failures, err := listenTcp(addrs, cfg.ListenPort)
 	if err != nil {
-		logs.Error("http file server listen %s address fail", address)
 		return nil, err
 	}
 
-	logs.Info("http file server listening on %s", address)
+	// net/http serves http/2 on a tls listener only when its alpn offers h2
+	httpsInfo := cfg.HttpsInfo
+	httpsInfo.ALPN = httpsAlpn(cfg.HttpsInfo, cfg.Http2Enable)
 
 	var tlsConfig *tls.Config
-	if cfg.HttpsEnable {
+	var acme *acmeManager
+	var certFiles *certFileWatcher
+	if cfg.HttpsEnable && cfg.HttpsInfo.Source == TlsSourceFile {
+		certFiles, err = newCertFileWatcher(cfg.HttpsInfo.CertFile, cfg.HttpsInfo.KeyFile)
+		if err != nil {
+			listenClose(listens)
+			logs.Error("load certificate files for http server fail, %s", err.Error())
+			return nil, err
+		}
+		tlsConfig, err = CreateFileTlsConfig(httpsInfo, certFiles)
+		if err != nil {
+			listenClose(listens)
+			logs.Error("create tls config for http server fail, %s", err.Error())
+			return nil, err
+		}
+	} else if cfg.HttpsEnable && cfg.HttpsInfo.Source == TlsSourceAcme {
+		acme, err = newAcmeManager(cfg.AcmeInfo)
+		if err != nil {
+			listenClose(listens)
+			logs.Error("create acme manager for http server fail, %s", err.Error())
+			return nil, err
+		}
+		tlsConfig, err = CreateAcmeTlsConfig(httpsInfo, acme)
+		if err != nil {
+			listenClose(listens)
+			logs.Error("create tls config for http server fail, %s", err.Error())
+			return nil, err
+		}
+	} else if cfg.HttpsEnable {
 		if cfg.HttpsInfo.Cert == "" || cfg.HttpsInfo.Key == "" {
-			listen.Close()
+			listenClose(listens)
 			return nil, fmt.Errorf("please configure the certificate and key on the tls edit page")
 		}
 
-		tlsConfig, err = CreateTlsConfig(cfg.HttpsInfo.Cert, cfg.HttpsInfo.Key)
+		tlsConfig, err = CreateTlsConfig(httpsInfo)
 		if err != nil {
-			listen.Close()
+			listenClose(listens)
 			logs.Error("create tls config for http server fail, %s", err.Error())
 			return nil, err
 		}
-		listen = tls.NewListener(listen, tlsConfig)
+	}
+
+	if tlsConfig != nil {
+		for i := range listens {
+			listens[i] = tls.NewListener(listens[i], tlsConfig)
+		}
+	}
+
+	var sni *sniCertificates
+	if tlsConfig != nil {
+		// a virtual host certificate wins over the sni entry of the same name
+		sniCerts := append([]SniCert{}, cfg.HttpsInfo.SniCerts...)
+		sni, err = newSniCertificates(append(sniCerts, VirtualHostSniCerts(cfg.Hosts)...))
+		if err != nil {
+			listenClose(listens)
+			logs.Error("load sni certificates for http server fail, %s", err.Error())
+			return nil, err
+		}
+		sni.Apply(tlsConfig)
+	}
+
+	if tlsConfig != nil && acme == nil {
+		var cert *tls.Certificate
+		if certFiles != nil {
+			cert = certFiles.Certificate()
+		} else {
+			cert = &tlsConfig.Certificates[0]
+		}
+		if err := certExpiredCheck(cert, cfg.CertAllowExpired); err != nil {
+			sni.Close()
+			listenClose(listens)
+			logs.Error("http server certificate check fail, %s", err.Error())
+			return nil, err
+		}
+	}
+
+	var h3 *http3Server
+	if tlsConfig != nil && cfg.Http3Enable {
+		conns, udpFailures, err := listenUdp(addrs, cfg.ListenPort)
+		failures = append(failures, udpFailures...)
+		if err != nil {
+			sni.Close()
+			listenClose(listens)
+			return nil, err
+		}
+		h3 = newHttp3Server(conns, tlsConfig, time.Duration(cfg.Timeout)*time.Second)
+	}
+
+	var plainListens []net.Listener
+	if tlsConfig != nil && cfg.HttpListenEnable {
+		var plainFailures []string
+		plainListens, plainFailures, err = listenTcp(addrs, cfg.HttpListenPort)
+		failures = append(failures, plainFailures...)
+		if err != nil {
+			if h3 != nil {
+				h3.Close()
+			}
+			sni.Close()
+			listenClose(listens)
+			return nil, err
+		}
 	}
 
 	fileHandler := &fileHandler{
-		route:       "/",
-		path:        cfg.ServerDir,
-		allowUpload: cfg.UploadEnable,
-		allowDelete: cfg.DeleteEnable,
-		allowZip:    cfg.ZipEnable,
-		allowAuth:   cfg.AuthEnable,
-		userList:    make([]UserInfo, len(cfg.AuthUsers)),
+		route:          "/",
+		path:           cfg.ServerDir,
+		allowUpload:    cfg.UploadEnable,
+		allowDelete:    cfg.DeleteEnable,
+		allowZip:       cfg.ZipEnable,
+		allowAuth:      cfg.AuthEnable,
+		allowWebdav:    cfg.WebdavEnable,
+		allowHttps:     cfg.HttpsEnable,
+		allowHsts:      cfg.HttpsEnable && cfg.HstsEnable,
+		uploadConflict: cfg.UploadConflict,
+		locks:          newDavLockSystem(),
+		uploads:        newTusUploads(),
+		userList:       make([]UserInfo, len(cfg.AuthUsers)),
+		passwords:      newPasswordCache(),
+		lockout:        newAuthLockout(cfg.AuthLockThreshold, cfg.AuthLockDuration, lockoutFilePath()),
+		acme:           acme,
+		certFiles:      certFiles,
+		sni:            sni,
+		http3:          h3,
+		allowStatus:    cfg.StatusEnable,
+		allowSite:      cfg.SiteEnable,
+		siteCleanURLs:  cfg.SiteCleanURLs,
+		siteFallback:   cfg.SiteFallback,
 	}
 
 	copy(fileHandler.userList, cfg.AuthUsers)
+	fileHandler.root = fileHandler
+
+	closeListens := func() {
+		listenClose(listens)
+		listenClose(plainListens)
+		if h3 != nil {
+			h3.Close()
+		}
+		if sni != nil {
+			sni.Close()
+		}
+	}
+
+	authEnable := cfg.AuthEnable
+	for _, mount := range cfg.Mounts {
+		authEnable = authEnable || mount.AuthEnable
+	}
+	for _, host := range cfg.Hosts {
+		authEnable = authEnable || host.AuthEnable
+	}
+	for _, proxy := range cfg.Proxies {
+		authEnable = authEnable || proxy.AuthEnable
+	}
+
+	if authEnable {
+		fileHandler.shares, err = newShareLinks(shareFilePath())
+		if err != nil {
+			closeListens()
+			logs.Error("create share link key fail, %s", err.Error())
+			return nil, err
+		}
+	}
+
+	if authEnable && cfg.AuthLoginEnable {
+		fileHandler.login, err = newSessionSigner(cfg.AuthSessionExpire)
+		if err != nil {
+			closeListens()
+			logs.Error("create login session key fail, %s", err.Error())
+			return nil, err
+		}
+	}
+
+	for _, mount := range cfg.Mounts {
+		fileHandler.mounts = append(fileHandler.mounts, fileHandler.mountNew(mount))
+	}
+	// the longest route is matched first
+	sort.SliceStable(fileHandler.mounts, func(i, j int) bool {
+		return len(fileHandler.mounts[i].route) > len(fileHandler.mounts[j].route)
+	})
+
+	for _, host := range cfg.Hosts {
+		fileHandler.hostAdd(host)
+	}
+	for _, proxy := range cfg.Proxies {
+		err = fileHandler.proxyAdd(proxy)
+		if err != nil {
+			closeListens()
+			logs.Error("create proxy route %s fail, %s", proxy.Route, err.Error())
+			return nil, err
+		}
+	}
+
+	if fileHandler.path != "" {
+		fileHandler.uploadCleanup(uploadExpire)
+	}
+	for _, mount := range fileHandler.mounts {
+		mount.uploadCleanup(uploadExpire)
+	}
+	for _, host := range fileHandler.hosts {
+		host.uploadCleanup(uploadExpire)
+	}
+
+	var handler http.Handler = fileHandler
+	if tlsConfig == nil {
+		handler = h2cHandler(cfg, handler)
+	}
 
 	httpserver := &http.Server{
-		Handler:      fileHandler,
+		Handler:      handler,
 		ReadTimeout:  time.Duration(cfg.Timeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.Timeout) * time.Second,
 		TLSConfig:    tlsConfig,
 	}
 
 	fileHandler.server = httpserver
-	fileHandler.Add(1)
 
-	go func() {
-		defer fileHandler.Done()
-		err = httpserver.Serve(listen)
+	if len(plainListens) > 0 {
+		fileHandler.plain = &http.Server{
+			Handler: h2cHandler(cfg, &plainHandler{
+				file:      fileHandler,
+				httpsPort: cfg.ListenPort,
+				redirect:  cfg.HttpRedirect,
+			}),
+			ReadTimeout:  time.Duration(cfg.Timeout) * time.Second,
+			WriteTimeout: time.Duration(cfg.Timeout) * time.Second,
+		}
+		for _, listen := range plainListens {
+			fileHandler.Add(1)
+			go func(listen net.Listener) {
+				defer fileHandler.Done()
+				err := fileHandler.plain.Serve(listen)
+				if err != nil && err != http.ErrServerClosed {
+					logs.Error("http server attach http listen instance fail, %s", err.Error())
+				}
+			}(listen)
+		}
+	}
+
+	fileHandler.failures = failures
+
+	for _, listen := range listens {
+		fileHandler.Add(1)
+		go func(listen net.Listener) {
+			defer fileHandler.Done()
+			err := httpserver.Serve(listen)
+			if err != nil {
+				logs.Error("http server attach listen instance fail, %s", err.Error())
+			} else {
+				httpserver.Close()
+			}
+		}(listen)
+	}
+
+	if h3 != nil {
+		h3.Start(fileHandler)
+	}
+	if certFiles != nil {
+		certFiles.Start()
+	}
+	if sni != nil {
+		sni.Start()
+	}
+
+	if tlsConfig != nil {
+		fileHandler.monitor = newCertMonitor(fileHandler.certificate, cfg.CertWarnDays)
+		fileHandler.monitor.Start()
+	}
+
+	if acme != nil {
+		shared := len(plainListens) > 0 && cfg.HttpListenPort == cfg.AcmeInfo.HttpPort
+		acmeFailures, err := acme.Start(addrs, cfg.ListenPort, shared)
+		fileHandler.failures = append(fileHandler.failures, acmeFailures...)
 		if err != nil {
-			logs.Error("http server attach listen instance fail, %s", err.Error())
-		} else {
-			httpserver.Close()
+			// the files are still served, the certificate may come from the
+			// cache or the next start
+			logs.Error("acme http challenge listen fail, %s", err.Error())
 		}
-	}()
+	}
 
 	return fileHandler, nil
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+)
+
+// testServe sends one request to the handler and returns the recorded answer
+func testServe(t *testing.T, h http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestServeAuth(t *testing.T) {
+	f := permissionTestHandler(t)
+	hashed := f.userList[0].Password
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{"no credentials", nil, http.StatusUnauthorized},
+		{"not basic", map[string]string{"Authorization": "Bearer abc"}, http.StatusUnauthorized},
+		{"unknown user", testBasicAuth("mallory", "secret"), http.StatusUnauthorized},
+		{"wrong password", testBasicAuth("intern", "hunter2"), http.StatusUnauthorized},
+		{"stored hash as password", testBasicAuth("intern", hashed), http.StatusUnauthorized},
+		{"password of another user", testBasicAuth("bob", "secret"), http.StatusUnauthorized},
+		{"valid", testBasicAuth("intern", "secret"), http.StatusOK},
+		{"valid from the cache", testBasicAuth("intern", "secret"), http.StatusOK},
+	}
+	for _, test := range tests {
+		w := testServe(t, f, http.MethodGet, "/a.txt", "", test.header)
+		if w.Code != test.status {
+			t.Errorf("%s: GET = %d, want %d", test.name, w.Code, test.status)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate challenge", test.name)
+		}
+	}
+}
+
+func TestServeHsts(t *testing.T) {
+	f := permissionTestHandler(t)
+	auth := testBasicAuth("intern", "secret")
+
+	if w := testServe(t, f, http.MethodGet, "https://files.test/a.txt", "", auth); w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("hsts sent while disabled")
+	}
+	f.allowHsts = true
+	w := testServe(t, f, http.MethodGet, "https://files.test/a.txt", "", auth)
+	if w.Code != http.StatusOK || w.Header().Get("Strict-Transport-Security") != "max-age=31536000" {
+		t.Errorf("https = %d, hsts %q", w.Code, w.Header().Get("Strict-Transport-Security"))
+	}
+	if w := testServe(t, f, http.MethodGet, "https://files.test/a.txt", "", nil); w.Header().Get("Strict-Transport-Security") == "" {
+		t.Errorf("hsts missing on the login challenge")
+	}
+	if w := testServe(t, f, http.MethodGet, "http://files.test/a.txt", "", auth); w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("hsts sent on plain http")
+	}
+}
+
+func TestServePlainListener(t *testing.T) {
+	f := permissionTestHandler(t)
+	m, client := testAcmeManager(t, AcmeChallengeHttp)
+	f.acme = m
+	challenge := &acme.Challenge{Type: AcmeChallengeHttp, Token: "token-1"}
+	if err := m.challengeSet(client, "files.test", challenge); err != nil {
+		t.Fatal(err)
+	}
+	auth := testBasicAuth("intern", "secret")
+
+	p := &plainHandler{file: f, httpsPort: 8443, redirect: true}
+	w := testServe(t, p, http.MethodGet, "http://files.test/docs/a.txt?zip=true", "", auth)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://files.test:8443/docs/a.txt?zip=true" {
+		t.Errorf("redirect = %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := testServe(t, p, http.MethodGet, "http://files.test"+acmeHttpPathPrefix+"token-1", "", nil); w.Code != http.StatusOK {
+		t.Errorf("acme challenge on the shared port = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	p.redirect = false
+	if w := testServe(t, p, http.MethodGet, "http://files.test/a.txt", "", auth); w.Code != http.StatusOK {
+		t.Errorf("plain without redirect = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := testServe(t, p, http.MethodGet, "http://files.test/a.txt", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("plain without credentials = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	sessionCookieName = "simple_http_session"
+	sessionSecretName = "session.key"
+
+	loginPath  = "/.auth/login"
+	logoutPath = "/.auth/logout"
+)
+
+const loginTemplateText = `
+<html>
+<head>
+	<title>Login</title>
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<style>body{font-family: sans-serif;}form{max-width:20em;margin:auto;}input{display:block;width:100%;margin:.5em 0;padding:.5em;box-sizing:border-box;}.error{color:#c00;}</style>
+</head>
+<body>
+<form method="post" action="{{ .Action }}">
+	<h1>Login</h1>
+	{{- if .Error }}
+	<p class=error>{{ .Error }}</p>
+	{{- end }}
+	<input type="hidden" name="next" value="{{ .Next }}"/>
+	<input required autofocus name="username" placeholder="Username" autocomplete="username"/>
+	<input required name="password" type="password" placeholder="Password" autocomplete="current-password"/>
+	<input type="submit" value="Login"/>
+</form>
+</body>
+</html>
+`
+
+type loginData struct {
+	Action string
+	Next   string
+	Error  string
+}
+
+var (
+	loginTemplate = template.Must(template.New("").Parse(loginTemplateText))
+)
+
+// sessionSigner issues the login cookie "user.expire.mac", the mac covers
+// the password hash too, so changing a password ends its sessions.
+type sessionSigner struct {
+	key    []byte
+	expire time.Duration
+}
+
+func newSessionSigner(seconds int64) (*sessionSigner, error) {
+	key, err := SecretGet(sessionSecretName)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionSigner{key: key, expire: time.Duration(seconds) * time.Second}, nil
+}
+
+func (s *sessionSigner) mac(user *UserInfo, expire int64) []byte {
+	h := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(h, "%s\n%d\n%s", user.UserName, expire, user.Password)
+	return h.Sum(nil)
+}
+
+func (s *sessionSigner) Issue(user *UserInfo) (string, time.Time) {
+	expire := time.Now().Add(s.expire)
+	value := fmt.Sprintf("%s.%d.%s",
+		base64.RawURLEncoding.EncodeToString([]byte(user.UserName)), expire.Unix(),
+		base64.RawURLEncoding.EncodeToString(s.mac(user, expire.Unix())))
+	return value, expire
+}
+
+func (s *sessionSigner) Verify(value string, userList []UserInfo) *UserInfo {
+	items := strings.Split(value, ".")
+	if len(items) != 3 {
+		return nil
+	}
+	username, err := base64.RawURLEncoding.DecodeString(items[0])
+	if err != nil {
+		return nil
+	}
+	expire, err := strconv.ParseInt(items[1], 10, 64)
+	if err != nil || time.Now().Unix() > expire {
+		return nil
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(items[2])
+	if err != nil {
+		return nil
+	}
+	for i, user := range userList {
+		if user.UserName == string(username) && hmac.Equal(sum, s.mac(&user, expire)) {
+			return &userList[i]
+		}
+	}
+	return nil
+}
+
+// sessionUser returns the user of a valid login cookie
+func (f *fileHandler) sessionUser(r *http.Request) *UserInfo {
+	if f.login == nil {
+		return nil
+	}
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil
+	}
+	return f.login.Verify(cookie.Value, f.userList)
+}
+
+// loginNext keeps the redirect after the login on this server
+func loginNext(value string) string {
+	next, err := url.Parse(value)
+	if err != nil || next.IsAbs() || next.Host != "" || !strings.HasPrefix(next.Path, "/") {
+		return "/"
+	}
+	// browsers read a backslash like a slash, "/\host" or "//host" leave
+	// the server, the escaped forms are decoded before the check
+	unescaped, err := url.PathUnescape(value)
+	if err != nil || strings.Contains(value, "\\") || strings.Contains(unescaped, "\\") ||
+		strings.HasPrefix(next.Path, "//") || strings.HasPrefix(unescaped, "//") {
+		return "/"
+	}
+	return next.String()
+}
+
+// loginRedirect sends browsers without a session to the login page, other
+// clients keep getting the basic auth challenge.
+func loginRedirect(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (f *fileHandler) serveLogin(w http.ResponseWriter, r *http.Request) error {
+	data := loginData{Action: loginPath, Next: loginNext(r.URL.Query().Get("next"))}
+
+	if r.Method == http.MethodPost {
+		data.Next = loginNext(r.PostFormValue("next"))
+
+		user, remain := f.authVerify(r, r.PostFormValue("username"), r.PostFormValue("password"))
+		if user != nil {
+			value, expire := f.login.Issue(user)
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookieName,
+				Value:    value,
+				Path:     "/",
+				Expires:  expire,
+				HttpOnly: true,
+				Secure:   f.allowHttps,
+				SameSite: http.SameSiteLaxMode,
+			})
+			logs.Info("http server [%s] login from %s", user.UserName, r.RemoteAddr)
+			http.Redirect(w, r, data.Next, http.StatusSeeOther)
+			return nil
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if remain > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(remain/time.Second)+1, 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+			data.Error = fmt.Sprintf("Too many failed logins, retry after %d seconds!", int64(remain/time.Second)+1)
+		} else {
+			w.WriteHeader(http.StatusUnauthorized)
+			data.Error = "Authentication failed, user or password error!"
+		}
+		return loginTemplate.Execute(w, data)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return loginTemplate.Execute(w, data)
+}
+
+func (f *fileHandler) serveLogout(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   f.allowHttps,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, loginPath, http.StatusSeeOther)
+	return nil
+}
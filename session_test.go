@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginNext(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/docs/a.txt", "/docs/a.txt"},
+		{"/docs/?zip=true", "/docs/?zip=true"},
+		{"/docs/a%20b.txt", "/docs/a%20b.txt"},
+		{"docs", "/"},
+		{"https://evil.test/", "/"},
+		{"//evil.test/", "/"},
+		{"///evil.test/", "/"},
+		{"/\\evil.test", "/"},
+		{"\\\\evil.test", "/"},
+		{"/%5Cevil.test", "/"},
+		{"/%2F/evil.test", "/"},
+		{"/%2fevil.test", "/"},
+		{"/%zz", "/"},
+		{"javascript:alert(1)", "/"},
+	}
+	for _, test := range tests {
+		if got := loginNext(test.value); got != test.want {
+			t.Errorf("loginNext(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestServeLogin(t *testing.T) {
+	f := permissionTestHandler(t)
+	f.login = &sessionSigner{key: make([]byte, secretLength), expire: time.Hour}
+	f.allowHttps = true
+
+	w := testServe(t, f, http.MethodGet, "/a.txt", "", map[string]string{"Accept": "text/html"})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != loginPath+"?next=%2Fa.txt" {
+		t.Errorf("browser GET without a session = %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := testServe(t, f, http.MethodGet, "/a.txt", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("client GET without a session = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	form := func(password string) string {
+		return url.Values{"username": {"intern"}, "password": {password}, "next": {"/a.txt"}}.Encode()
+	}
+	header := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	if w := testServe(t, f, http.MethodPost, loginPath, form("wrong"), header); w.Code != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// the request is plain http, Secure follows the https setting of the
+	// server which may sit behind a proxy
+	w = testServe(t, f, http.MethodPost, loginPath, form("secret"), header)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/a.txt" {
+		t.Fatalf("login = %d %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("login cookies = %v", cookies)
+	}
+	session := cookies[0].Name + "=" + cookies[0].Value
+
+	if w := testServe(t, f, http.MethodGet, "/a.txt", "", map[string]string{"Cookie": session}); w.Code != http.StatusOK {
+		t.Errorf("GET with the session = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := testServe(t, f, http.MethodGet, "/docs/private/s.txt", "", map[string]string{"Cookie": session}); w.Code != http.StatusForbidden {
+		t.Errorf("GET with the session below a denied path = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	forged := strings.Replace(session, cookies[0].Value[:4], "Ym9i", 1)
+	if w := testServe(t, f, http.MethodGet, "/a.txt", "", map[string]string{"Cookie": forged}); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET with a forged session = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = testServe(t, f, http.MethodGet, logoutPath, "", map[string]string{"Cookie": session})
+	cookies = w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || len(cookies) != 1 || cookies[0].MaxAge >= 0 || !cookies[0].Secure {
+		t.Errorf("logout = %d, cookies %v", w.Code, cookies)
+	}
+
+	f.allowHttps = false
+	w = testServe(t, f, http.MethodPost, loginPath, form("secret"), header)
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Secure {
+		t.Errorf("login cookies without https = %v", cookies)
+	}
+}
+
+func TestSecretGet(t *testing.T) {
+	home := DEFAULT_HOME
+	DEFAULT_HOME = t.TempDir()
+	defer func() { DEFAULT_HOME = home }()
+
+	key, err := SecretGet("test.key")
+	if err != nil || len(key) != secretLength {
+		t.Fatalf("SecretGet = %x, %v", key, err)
+	}
+	again, err := SecretGet("test.key")
+	if err != nil || !bytes.Equal(key, again) {
+		t.Fatalf("SecretGet again = %x, %v, want %x", again, err, key)
+	}
+
+	// a broken or unreadable key is not silently replaced
+	filePath := fmt.Sprintf("%s%c%s", ConfigDirGet(), os.PathSeparator, "short.key")
+	if err := os.WriteFile(filePath, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SecretGet("short.key"); err == nil {
+		t.Error("SecretGet of a short key succeeded")
+	}
+	if value, _ := os.ReadFile(filePath); string(value) != "short" {
+		t.Errorf("short key replaced by %x", value)
+	}
+	if err := os.Mkdir(fmt.Sprintf("%s%c%s", ConfigDirGet(), os.PathSeparator, "dir.key"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SecretGet("dir.key"); err == nil {
+		t.Error("SecretGet of an unreadable key succeeded")
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	shareKey        = "share"
+	shareSecretName = "share.key"
+	shareFileName   = "shares.json"
+	// random bytes of a link id, 16 hex characters in the token
+	shareIDSize = 8
+
+	sharePath = "/.auth/share"
+)
+
+const shareTemplateText = `
+<html>
+<head>
+	<title>Share {{ .Path }}</title>
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<style>body{font-family: sans-serif;}input{width:100%;padding:.5em;box-sizing:border-box;}</style>
+</head>
+<body>
+<h1>Share {{ .Path }}</h1>
+<p>Read access until {{ .Expire }}{{ if .Limit }}, {{ .Limit }} downloads{{ end }}.</p>
+<input readonly onfocus="this.select()" value="{{ .URL }}"/>
+<p><a href="{{ .Back }}">Back</a></p>
+</body>
+</html>
+`
+
+type shareData struct {
+	Path   string
+	URL    string
+	Back   string
+	Expire string
+	Limit  int64
+}
+
+var (
+	shareTemplate = template.Must(template.New("").Parse(shareTemplateText))
+)
+
+type shareLinkKey struct{}
+
+// shareLink is decoded from the token "path.expire.limit.id.mac" of a share
+// url, it grants read access to Path and everything below it. Host is the
+// virtual host the link belongs to, it is signed but not part of the token.
+type shareLink struct {
+	Host   string
+	Path   string
+	Expire int64
+	Limit  int64
+	ID     string
+}
+
+type shareEntry struct {
+	Used   int64
+	Expire int64
+}
+
+// shareLinks signs the links and counts their downloads, the counters are
+// kept next to config.json so a restart does not reset the limits.
+type shareLinks struct {
+	sync.Mutex
+
+	key      []byte
+	filePath string
+	entries  map[string]*shareEntry
+}
+
+func shareFilePath() string {
+	return fmt.Sprintf("%s%c%s", ConfigDirGet(), os.PathSeparator, shareFileName)
+}
+
+func newShareLinks(filePath string) (*shareLinks, error) {
+	key, err := SecretGet(shareSecretName)
+	if err != nil {
+		return nil, err
+	}
+	s := &shareLinks{
+		key:      key,
+		filePath: filePath,
+		entries:  make(map[string]*shareEntry),
+	}
+
+	value, err := os.ReadFile(filePath)
+	if err != nil {
+		return s, nil
+	}
+	err = json.Unmarshal(value, &s.entries)
+	if err != nil {
+		logs.Error("json unmarshal share list fail, %s", err.Error())
+		s.entries = make(map[string]*shareEntry)
+	}
+	return s, nil
+}
+
+// mac signs every field of the link, the host and path are length prefixed
+// so no two links share the signed text.
+func (s *shareLinks) mac(link *shareLink) string {
+	h := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(h, "%d:%s\n%d:%s\n%d\n%d\n%s",
+		len(link.Host), link.Host, len(link.Path), link.Path, link.Expire, link.Limit, link.ID)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (s *shareLinks) Create(host, urlPath string, expire time.Duration, limit int64) (*shareLink, string, error) {
+	buf := make([]byte, shareIDSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	link := &shareLink{
+		Host:   host,
+		Path:   urlPath,
+		Expire: time.Now().Add(expire).Unix(),
+		Limit:  limit,
+		ID:     hex.EncodeToString(buf),
+	}
+	token := fmt.Sprintf("%s.%d.%d.%s.%s",
+		base64.RawURLEncoding.EncodeToString([]byte(link.Path)),
+		link.Expire, link.Limit, link.ID, s.mac(link))
+	return link, token, nil
+}
+
+// Verify returns the link of a token with a valid signature, expired or used
+// up links are returned too and checked by Valid.
+func (s *shareLinks) Verify(host, token string) *shareLink {
+	items := strings.Split(token, ".")
+	if len(items) != 5 {
+		return nil
+	}
+	linkPath, err := base64.RawURLEncoding.DecodeString(items[0])
+	if err != nil {
+		return nil
+	}
+	expire, err := strconv.ParseInt(items[1], 10, 64)
+	if err != nil {
+		return nil
+	}
+	limit, err := strconv.ParseInt(items[2], 10, 64)
+	if err != nil {
+		return nil
+	}
+	// the id keys the download counters, only the ids Create makes are taken
+	id, err := hex.DecodeString(items[3])
+	if err != nil || len(id) != shareIDSize || hex.EncodeToString(id) != items[3] {
+		return nil
+	}
+	link := &shareLink{Host: host, Path: string(linkPath), Expire: expire, Limit: limit, ID: items[3]}
+	if !hmac.Equal([]byte(items[4]), []byte(s.mac(link))) {
+		return nil
+	}
+	return link
+}
+
+func (s *shareLinks) Valid(link *shareLink) bool {
+	if time.Now().Unix() > link.Expire {
+		return false
+	}
+	if link.Limit <= 0 {
+		return true
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	entry, ok := s.entries[link.ID]
+	return !ok || entry.Used < link.Limit
+}
+
+// Take counts one download of the link, false when the limit is used up
+func (s *shareLinks) Take(link *shareLink) bool {
+	if link.Limit <= 0 {
+		return true
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	entry, ok := s.entries[link.ID]
+	if !ok {
+		entry = &shareEntry{Expire: link.Expire}
+		s.entries[link.ID] = entry
+	}
+	if entry.Used >= link.Limit {
+		return false
+	}
+	entry.Used++
+	s.save()
+	return true
+}
+
+func (s *shareLinks) save() {
+	now := time.Now().Unix()
+	for id, entry := range s.entries {
+		if now > entry.Expire {
+			delete(s.entries, id)
+		}
+	}
+	value, err := json.MarshalIndent(s.entries, "\t", " ")
+	if err != nil {
+		logs.Error("json marshal share list fail, %s", err.Error())
+		return
+	}
+	err = os.WriteFile(s.filePath, value, 0664)
+	if err != nil {
+		logs.Error("save share list fail, %s", err.Error())
+	}
+}
+
+// User is the read only account the link stands for inside the handler
+func (link *shareLink) User() *UserInfo {
+	return &UserInfo{
+		UserName:    "share-" + link.ID,
+		Permissions: []string{},
+		PathRules: []PathRule{
+			{Path: link.Path, Permissions: []string{PermRead, PermZip}},
+		},
+	}
+}
+
+// shareRedact hides the token of a share url, the runlog must not hand out
+// working links.
+func shareRedact(u *url.URL) string {
+	query := u.Query()
+	if !query.Has(shareKey) {
+		return u.String()
+	}
+	query.Set(shareKey, "redacted")
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+func shareLinkSet(r *http.Request, link *shareLink) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), shareLinkKey{}, link))
+}
+
+func shareLinkGet(r *http.Request) *shareLink {
+	link, _ := r.Context().Value(shareLinkKey{}).(*shareLink)
+	return link
+}
+
+// shareDownload counts a download of a shared file, requests for a later
+// part of the file resume a download already counted.
+func (f *fileHandler) shareDownload(r *http.Request) bool {
+	link := shareLinkGet(r)
+	if link == nil || r.Method != http.MethodGet {
+		return true
+	}
+	if value := r.Header.Get("Range"); value != "" && !strings.HasPrefix(value, "bytes=0-") {
+		return true
+	}
+	return f.shares.Take(link)
+}
+
+// shareAuth checks the share token of the request, the second result is
+// false when the request carries a token which grants nothing.
+func (f *fileHandler) shareAuth(w http.ResponseWriter, r *http.Request) (*shareLink, bool) {
+	token := r.URL.Query().Get(shareKey)
+	if token == "" || f.shares == nil {
+		return nil, true
+	}
+	link := f.shares.Verify(f.host, token)
+	if link == nil {
+		logs.Warning("http server %s invalid share link for %s", r.RemoteAddr, r.URL.Path)
+		_ = f.serveStatus(w, r, http.StatusForbidden)
+		return nil, false
+	}
+	if !f.shares.Valid(link) {
+		_ = f.serveStatus(w, r, http.StatusGone)
+		return nil, false
+	}
+	return link, true
+}
+
+func (f *fileHandler) serveShare(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return f.serveStatus(w, r, http.StatusMethodNotAllowed)
+	}
+
+	linkPath := path.Clean("/" + r.PostFormValue("path"))
+	if mount := f.mountGet(linkPath); mount != f {
+		return mount.serveShare(w, r)
+	}
+	// the root without a folder only lists the mounts, nothing to share
+	if f.path == "" {
+		return os.ErrNotExist
+	}
+	if !f.allowAuth || !f.permit(r, linkPath, PermShare) || shareLinkGet(r) != nil {
+		return f.serveStatus(w, r, http.StatusForbidden)
+	}
+	if _, err := os.Stat(f.osPathGet(linkPath)); err != nil {
+		return err
+	}
+	hours, err := strconv.ParseInt(r.PostFormValue("hours"), 10, 64)
+	if err != nil || hours <= 0 {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	}
+	limit, err := strconv.ParseInt(r.PostFormValue("limit"), 10, 64)
+	if err != nil || limit < 0 {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	}
+
+	link, token, err := f.shares.Create(f.host, linkPath, time.Duration(hours)*time.Hour, limit)
+	if err != nil {
+		return err
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	shareURL := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     link.Path,
+		RawQuery: url.Values{shareKey: {token}}.Encode(),
+	}
+
+	var user string
+	if authUser := authUserGet(r); authUser != nil {
+		user = authUser.UserName
+	}
+	logs.Info("http server [%s] share %s as %s for %d hours, %d downloads",
+		user, link.Path, link.ID, hours, limit)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return shareTemplate.Execute(w, shareData{
+		Path:   link.Path,
+		URL:    shareURL.String(),
+		Back:   loginNext(r.PostFormValue("back")),
+		Expire: time.Unix(link.Expire, 0).Format("2006-01-02 15:04:05"),
+		Limit:  link.Limit,
+	})
+}
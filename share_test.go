@@ -0,0 +1,217 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareLinksVerify(t *testing.T) {
+	shares := &shareLinks{key: []byte("share test key"), entries: make(map[string]*shareEntry)}
+	other := &shareLinks{key: []byte("another key"), entries: make(map[string]*shareEntry)}
+
+	link, token, err := shares.Create("", "/docs/a.txt", time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hostToken, err := shares.Create("files.test", "/docs/a.txt", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := strings.Split(token, ".")
+	// a token signed for another id, the mac itself is valid
+	resigned := func(id string) string {
+		forged := *link
+		forged.ID = id
+		return strings.Join([]string{items[0], items[1], items[2], id, shares.mac(&forged)}, ".")
+	}
+
+	tests := []struct {
+		name   string
+		shares *shareLinks
+		host   string
+		token  string
+		want   bool
+	}{
+		{"valid", shares, "", token, true},
+		{"host", shares, "files.test", hostToken, true},
+		{"host mismatch", shares, "other.test", hostToken, false},
+		{"default host token on a vhost", shares, "files.test", token, false},
+		{"vhost token on the default host", shares, "", hostToken, false},
+		{"other key", other, "", token, false},
+		{"empty", shares, "", "", false},
+		{"short", shares, "", strings.Join(items[:4], "."), false},
+		{"path", shares, "", strings.Join([]string{"L2RvY3M", items[1], items[2], items[3], items[4]}, "."), false},
+		{"expire", shares, "", strings.Join([]string{items[0], "9999999999", items[2], items[3], items[4]}, "."), false},
+		{"limit", shares, "", strings.Join([]string{items[0], items[1], "0", items[3], items[4]}, "."), false},
+		{"bad limit", shares, "", strings.Join([]string{items[0], items[1], "x", items[3], items[4]}, "."), false},
+		{"signed id", shares, "", resigned("0123456789abcdef"), true},
+		{"short id", shares, "", resigned("0123456789abcde"), false},
+		{"long id", shares, "", resigned("0123456789abcdef0"), false},
+		{"upper case id", shares, "", resigned("0123456789ABCDEF"), false},
+		{"id not hex", shares, "", resigned("0123456789abcdeg"), false},
+	}
+	for _, test := range tests {
+		got := test.shares.Verify(test.host, test.token)
+		if (got != nil) != test.want {
+			t.Errorf("%s: Verify = %v, want valid %v", test.name, got, test.want)
+			continue
+		}
+		if got != nil && test.token == token && *got != *link {
+			t.Errorf("%s: Verify = %+v, want %+v", test.name, *got, *link)
+		}
+	}
+}
+
+func TestShareLinksMac(t *testing.T) {
+	shares := &shareLinks{key: []byte("share test key")}
+	// moving text between the host and the path must change the signature
+	links := []shareLink{
+		{Host: "", Path: "/a", Expire: 1, Limit: 2, ID: "0123456789abcdef"},
+		{Host: "a", Path: "/", Expire: 1, Limit: 2, ID: "0123456789abcdef"},
+		{Host: "1:a\n", Path: "/a", Expire: 1, Limit: 2, ID: "0123456789abcdef"},
+		{Host: "", Path: "/a\n1", Expire: 1, Limit: 2, ID: "0123456789abcdef"},
+	}
+	seen := make(map[string]int)
+	for i := range links {
+		mac := shares.mac(&links[i])
+		if j, ok := seen[mac]; ok {
+			t.Errorf("links %+v and %+v share a mac", links[j], links[i])
+		}
+		seen[mac] = i
+	}
+}
+
+func TestShareRedact(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"/docs/a.txt", "/docs/a.txt"},
+		{"/docs/?zip=true", "/docs/?zip=true"},
+		{"/docs/a.txt?share=abc.def", "/docs/a.txt?share=redacted"},
+		{"/docs/?share=abc&zip=true", "/docs/?share=redacted&zip=true"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := shareRedact(u); got != test.want {
+			t.Errorf("shareRedact(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+// shareTestHandler lets intern share below / with the files of
+// permissionTestHandler
+func shareTestHandler(t *testing.T) *fileHandler {
+	f := permissionTestHandler(t)
+	f.userList[0].Permissions = append(f.userList[0].Permissions, PermShare)
+	f.shares = &shareLinks{
+		key:      []byte("share test key"),
+		filePath: filepath.Join(t.TempDir(), shareFileName),
+		entries:  make(map[string]*shareEntry),
+	}
+	return f
+}
+
+func TestServeShareCreate(t *testing.T) {
+	f := shareTestHandler(t)
+
+	tests := []struct {
+		user     string
+		password string
+		path     string
+		hours    string
+		status   int
+	}{
+		{"intern", "secret", "/a.txt", "1", http.StatusOK},
+		// the path rule of /docs does not grant share
+		{"intern", "secret", "/docs/", "1", http.StatusForbidden},
+		{"intern", "secret", "/docs/private/s.txt", "1", http.StatusForbidden},
+		{"intern", "secret", "/missing.txt", "1", http.StatusNotFound},
+		{"intern", "secret", "/a.txt", "0", http.StatusBadRequest},
+		{"bob", "hunter2", "/a.txt", "1", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		header := testBasicAuth(test.user, test.password)
+		header["Content-Type"] = "application/x-www-form-urlencoded"
+		body := url.Values{"path": {test.path}, "hours": {test.hours}, "limit": {"0"}}.Encode()
+		w := testServe(t, f, http.MethodPost, sharePath, body, header)
+		if w.Code != test.status {
+			t.Errorf("%s shares %s = %d, want %d", test.user, test.path, w.Code, test.status)
+		}
+		if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), shareKey+"=") {
+			t.Errorf("%s shares %s, no link in %q", test.user, test.path, w.Body.String())
+		}
+	}
+
+	// a share link does not grant sharing further
+	_, token, err := f.shares.Create("", "/", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := url.Values{"path": {"/a.txt"}, "hours": {"1"}, "limit": {"0"}}.Encode()
+	w := testServe(t, f, http.MethodPost, sharePath+"?"+shareKey+"="+token, body,
+		map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("share with a share link = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestServeShareAccess(t *testing.T) {
+	f := shareTestHandler(t)
+	_, fileToken, err := f.shares.Create("", "/a.txt", time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dirToken, err := f.shares.Create("", "/docs", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, expired, err := f.shares.Create("", "/a.txt", -time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		status int
+	}{
+		{"file", http.MethodGet, "/a.txt", fileToken, http.StatusOK},
+		{"file again", http.MethodGet, "/a.txt", fileToken, http.StatusOK},
+		{"file used up", http.MethodGet, "/a.txt", fileToken, http.StatusGone},
+		{"file of the folder", http.MethodGet, "/docs/a.txt", dirToken, http.StatusOK},
+		{"folder listing", http.MethodGet, "/docs/", dirToken, http.StatusOK},
+		{"folder zip", http.MethodGet, "/docs/?" + zipKey + "=1", dirToken, http.StatusOK},
+		{"outside the folder", http.MethodGet, "/a.txt", dirToken, http.StatusForbidden},
+		{"sibling prefix", http.MethodGet, "/docsx", dirToken, http.StatusForbidden},
+		{"delete", http.MethodDelete, "/docs/a.txt", dirToken, http.StatusForbidden},
+		{"expired", http.MethodGet, "/a.txt", expired, http.StatusGone},
+		{"forged", http.MethodGet, "/a.txt", "x" + dirToken, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		target := test.target + "?" + shareKey + "=" + url.QueryEscape(test.token)
+		if strings.Contains(test.target, "?") {
+			target = test.target + "&" + shareKey + "=" + url.QueryEscape(test.token)
+		}
+		w := testServe(t, f, test.method, target, "", nil)
+		if w.Code != test.status {
+			t.Errorf("%s: %s %s = %d, want %d", test.name, test.method, test.target, w.Code, test.status)
+		}
+	}
+
+	// the download counter is kept for a restart
+	value, err := os.ReadFile(f.shares.filePath)
+	if err != nil || !strings.Contains(string(value), `"Used": 2`) {
+		t.Errorf("%s = %q, %v", shareFileName, value, err)
+	}
+}
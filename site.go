@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// siteIndexFiles are served for a folder in site mode, the first one found
+var siteIndexFiles = []string{"index.html", "index.htm"}
+
+// SiteFallbackParse cleans the url path of the fallback file, an empty
+// value turns the fallback off.
+func SiteFallbackParse(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	output := path.Clean("/" + value)
+	if output == "/" || strings.HasSuffix(value, "/") {
+		return "", fmt.Errorf("site fallback %s must be a file like /index.html", value)
+	}
+	return output, nil
+}
+
+func siteIndex(osPath string) string {
+	for _, name := range siteIndexFiles {
+		file := filepath.Join(osPath, name)
+		if stat, err := os.Stat(file); err == nil && !stat.IsDir() {
+			return file
+		}
+	}
+	return ""
+}
+
+func siteFile(osPath string) bool {
+	stat, err := os.Stat(osPath)
+	return err == nil && !stat.IsDir()
+}
+
+// serveSite serves the folder like a static web site, false leaves the
+// request to the file listing.
+func (f *fileHandler) serveSite(w http.ResponseWriter, r *http.Request, urlPath, osPath string) bool {
+	info, err := os.Stat(osPath)
+	switch {
+	case err == nil && info.IsDir():
+		index := siteIndex(osPath)
+		if index == "" {
+			return false
+		}
+		// relative links of the page need the trailing slash
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+			return true
+		}
+		http.ServeFile(w, r, index)
+		return true
+	case err == nil, !os.IsNotExist(err):
+		return false
+	}
+
+	if f.siteCleanURLs && path.Ext(urlPath) == "" && siteFile(osPath+".html") &&
+		f.permit(r, urlPath+".html", PermRead) {
+		http.ServeFile(w, r, osPath+".html")
+		return true
+	}
+
+	// single page apps route unknown paths in the browser, the fallback is
+	// checked like a request for it
+	if f.siteFallback != "" {
+		fallbackURLPath := path.Join(f.route, f.siteFallback)
+		if !f.permit(r, fallbackURLPath, PermRead) {
+			return false
+		}
+		fallback := f.osPathGet(fallbackURLPath)
+		if siteFile(fallback) && !uploadStagePath(f.siteFallback) {
+			http.ServeFile(w, r, fallback)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteFallbackParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		valid bool
+	}{
+		{"", "", true},
+		{" index.html ", "/index.html", true},
+		{"/app/../index.html", "/index.html", true},
+		{"/", "", false},
+		{"/app/", "", false},
+	}
+	for _, test := range tests {
+		got, err := SiteFallbackParse(test.value)
+		if got != test.want || (err == nil) != test.valid {
+			t.Errorf("SiteFallbackParse(%q) = %q, %v", test.value, got, err)
+		}
+	}
+}
+
+func TestServeSite(t *testing.T) {
+	f := permissionTestHandler(t)
+	for name, value := range map[string]string{
+		"index.html":      "home page",
+		"about.html":      "about page",
+		"secret.html":     "secret page",
+		"blog/index.htm":  "blog page",
+		"empty/x.txt":     "x",
+		"docs/guide.html": "guide page",
+	} {
+		file := filepath.Join(f.path, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.userList[0].PathRules = append(f.userList[0].PathRules, PathRule{Path: "/secret.html"})
+	f.shares = &shareLinks{key: []byte("share test key"), entries: make(map[string]*shareEntry)}
+	f.allowSite = true
+	intern := testBasicAuth("intern", "secret")
+
+	tests := []struct {
+		name     string
+		target   string
+		cleanURL bool
+		fallback string
+		status   int
+		body     string
+	}{
+		{"index of the root", "/", false, "", http.StatusOK, "home page"},
+		{"index.htm of a folder", "/blog/", false, "", http.StatusOK, "blog page"},
+		{"folder without slash", "/blog?x=1", false, "", http.StatusMovedPermanently, "/blog/?x=1"},
+		{"folder without index", "/empty/", false, "", http.StatusOK, "x.txt"},
+		{"file", "/a.txt", false, "", http.StatusOK, "a.txt"},
+		{"zip is not a page", "/?" + zipKey + "=true", false, "", http.StatusOK, ""},
+		{"clean url off", "/about", false, "", http.StatusNotFound, ""},
+		{"clean url", "/about", true, "", http.StatusOK, "about page"},
+		{"clean url in a folder", "/docs/guide", true, "", http.StatusOK, "guide page"},
+		{"clean url of a denied file", "/secret", true, "", http.StatusNotFound, ""},
+		{"fallback", "/app/route/1", false, "/index.html", http.StatusOK, "home page"},
+		{"fallback off", "/app/route/1", false, "", http.StatusNotFound, ""},
+		{"fallback to a denied file", "/app/route/1", false, "/secret.html", http.StatusNotFound, ""},
+		{"fallback to a missing file", "/app/route/1", false, "/missing.html", http.StatusNotFound, ""},
+		{"fallback in a denied folder", "/docs/private/x", false, "/index.html", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		f.siteCleanURLs, f.siteFallback = test.cleanURL, test.fallback
+		w := testServe(t, f, http.MethodGet, test.target, "", intern)
+		got := w.Body.String() + w.Header().Get("Location")
+		if w.Code != test.status || !strings.Contains(got, test.body) {
+			t.Errorf("%s: GET %s = %d %q, want %d %q", test.name, test.target, w.Code, got, test.status, test.body)
+		}
+	}
+
+	// a share link gets the file it names, not the page of the site
+	f.siteFallback = "/index.html"
+	_, token, err := f.shares.Create("", "/docs", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := testServe(t, f, http.MethodGet, "/docs/missing?"+shareKey+"="+token, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("fallback with a share link = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
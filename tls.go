@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
+	"strings"
 
 	"github.com/astaxie/beego/logs"
 	"github.com/lxn/walk"
@@ -12,6 +14,9 @@ func TlsAction() {
 	var dlg *walk.Dialog
 	var acceptPB, cancelPB *walk.PushButton
 	var tlsCA, tlsCert, tlsKey *walk.TextEdit
+	var clientAuth, source *walk.ComboBox
+	var certFile, keyFile, warnDays *walk.LineEdit
+	var allowExpired *walk.CheckBox
 
 	_, err := Dialog{
 		AssignTo:      &dlg,
@@ -19,13 +24,29 @@ func TlsAction() {
 		Icon:          walk.IconInformation(),
 		DefaultButton: &acceptPB,
 		CancelButton:  &acceptPB,
-		Size:          Size{Width: 450, Height: 300},
-		MinSize:       Size{Width: 450, Height: 300},
+		Size:          Size{Width: 450, Height: 480},
+		MinSize:       Size{Width: 450, Height: 480},
 		Layout:        VBox{},
 		Children: []Widget{
 			Composite{
 				Layout: Grid{Columns: 2},
 				Children: []Widget{
+					Label{
+						Text: "Source: ",
+					},
+					ComboBox{
+						AssignTo: &source,
+						CurrentIndex: func() int {
+							for i, item := range TlsSourceOptions() {
+								if ConfigGet().HttpsInfo.Source == item {
+									return i
+								}
+							}
+							return 0
+						},
+						Model:       TlsSourceOptions(),
+						ToolTipText: "Use the pem below, the certificate files or the certificate issued by the ACME directory",
+					},
 					Label{
 						Text: "TLS CA: ",
 					},
@@ -53,6 +74,54 @@ func TlsAction() {
 						Text:     ConfigGet().HttpsInfo.Key,
 						VScroll:  true,
 					},
+					Label{
+						Text: "Cert File: ",
+					},
+					LineEdit{
+						AssignTo:    &certFile,
+						Text:        ConfigGet().HttpsInfo.CertFile,
+						ToolTipText: "Path of the pem certificate chain, reloaded when the file changes",
+					},
+					Label{
+						Text: "Key File: ",
+					},
+					LineEdit{
+						AssignTo:    &keyFile,
+						Text:        ConfigGet().HttpsInfo.KeyFile,
+						ToolTipText: "Path of the pem private key, reloaded when the file changes",
+					},
+					Label{
+						Text: "Client Auth: ",
+					},
+					ComboBox{
+						AssignTo: &clientAuth,
+						CurrentIndex: func() int {
+							for i, item := range ClientAuthOptions() {
+								if ConfigGet().HttpsInfo.ClientAuth == item {
+									return i
+								}
+							}
+							return 0
+						},
+						Model:       ClientAuthOptions(),
+						ToolTipText: "Verify client certificates against the TLS CA, optional falls back to the password",
+					},
+					Label{
+						Text: "Expiry Warn: ",
+					},
+					LineEdit{
+						AssignTo:    &warnDays,
+						Text:        CertWarnDaysFormat(ConfigGet().CertWarnDays),
+						ToolTipText: "Days before the certificate expires a warning is logged, separated by comma",
+					},
+					Label{
+						Text: "Expired: ",
+					},
+					CheckBox{
+						AssignTo: &allowExpired,
+						Text:     "Allow starting with an expired certificate",
+						Checked:  ConfigGet().CertAllowExpired,
+					},
 				},
 			},
 			Composite{
@@ -63,19 +132,63 @@ func TlsAction() {
 						AssignTo: &acceptPB,
 						Text:     "Save",
 						OnClicked: func() {
-							if tlsCert.Text() != "" || tlsKey.Text() != "" {
-								_, err := CreateTlsConfig(tlsCert.Text(), tlsKey.Text())
+							// the policy fields are kept as saved by the policy dialog
+							info := ConfigGet().HttpsInfo
+							info.Source = source.Text()
+							info.CA = tlsCA.Text()
+							info.Cert = tlsCert.Text()
+							info.Key = tlsKey.Text()
+							info.CertFile = strings.TrimSpace(certFile.Text())
+							info.KeyFile = strings.TrimSpace(keyFile.Text())
+							info.ClientAuth = clientAuth.Text()
+
+							err := TlsInfoCheck(info)
+							if err != nil {
+								ErrorBoxAction(mainWindow, err.Error())
+								return
+							}
+
+							if info.Source == TlsSourceFile {
+								_, err := tls.LoadX509KeyPair(info.CertFile, info.KeyFile)
+								if err != nil {
+									ErrorBoxAction(mainWindow, fmt.Sprintf("TLS Cert File or Key File maybe invalid! %s", err.Error()))
+									return
+								}
+							}
+
+							if info.Source == TlsSourceAcme {
+								err := AcmeInfoCheck(ConfigGet().AcmeInfo)
 								if err != nil {
-									ErrorBoxAction(mainWindow, fmt.Sprintf("TLS Cert or Key maybe invalid! %s", err.Error()))
+									ErrorBoxAction(mainWindow, err.Error())
 									return
 								}
 							}
 
-							err := HttpsInfoSave(TlsInfo{
-								CA:   tlsCA.Text(),
-								Cert: tlsCert.Text(),
-								Key:  tlsKey.Text(),
-							})
+							if info.Cert != "" || info.Key != "" {
+								_, err := CreateTlsConfig(info)
+								if err != nil {
+									ErrorBoxAction(mainWindow, fmt.Sprintf("TLS Cert, Key or CA maybe invalid! %s", err.Error()))
+									return
+								}
+							}
+
+							days, err := CertWarnDaysParse(warnDays.Text())
+							if err != nil {
+								ErrorBoxAction(mainWindow, err.Error())
+								return
+							}
+
+							err = HttpsInfoSave(info)
+							if err != nil {
+								ErrorBoxAction(mainWindow, err.Error())
+								return
+							}
+							err = CertWarnDaysSave(days)
+							if err != nil {
+								ErrorBoxAction(mainWindow, err.Error())
+								return
+							}
+							err = CertAllowExpiredSave(allowExpired.Checked())
 							if err != nil {
 								ErrorBoxAction(mainWindow, err.Error())
 								return
@@ -88,9 +201,50 @@ func TlsAction() {
 					PushButton{
 						Text: "Generate",
 						OnClicked: func() {
-							cert, key := GenerateKeyCert(ConfigGet().ListenAddr)
-							tlsCert.SetText(cert)
-							tlsKey.SetText(key)
+							cert, key, ok := CertGenerateAction(dlg)
+							if ok {
+								tlsCert.SetText(cert)
+								tlsKey.SetText(key)
+							}
+						},
+					},
+					HSpacer{},
+					PushButton{
+						Text: "ACME",
+						OnClicked: func() {
+							AcmeAction(dlg)
+						},
+					},
+					HSpacer{},
+					PushButton{
+						Text: "Policy",
+						OnClicked: func() {
+							TlsPolicyAction(dlg)
+						},
+					},
+					HSpacer{},
+					PushButton{
+						Text: "Export CA",
+						OnClicked: func() {
+							dlgFile := new(walk.FileDialog)
+							dlgFile.FilePath = "simple-http-server-ca.crt"
+							dlgFile.Filter = "PEM Certificate (*.crt;*.pem)|*.crt;*.pem|DER Certificate (*.cer;*.der)|*.cer;*.der"
+							dlgFile.Title = "Please select where to save the local CA certificate"
+
+							exist, err := dlgFile.ShowSave(dlg)
+							if err != nil {
+								logs.Error(err.Error())
+								return
+							}
+							if !exist {
+								return
+							}
+							err = CertAuthorityExport(dlgFile.FilePath)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							logs.Info("export local CA certificate to %s", dlgFile.FilePath)
 						},
 					},
 					HSpacer{},
@@ -111,3 +265,382 @@ func TlsAction() {
 		logs.Error(err.Error())
 	}
 }
+
+// CertGenerateAction asks for the options of a new self signed certificate,
+// the addresses of all interfaces and the host name are always included.
+func CertGenerateAction(owner walk.Form) (string, string, bool) {
+	var dlg *walk.Dialog
+	var acceptPB, cancelPB *walk.PushButton
+	var dnsNames *walk.LineEdit
+	var keyType *walk.ComboBox
+	var days *walk.NumberEdit
+	var signByCA *walk.CheckBox
+	var cert, key string
+
+	options := ConfigGet().CertGenerate
+
+	cmd, err := Dialog{
+		AssignTo:      &dlg,
+		Title:         "Certificate Generate",
+		Icon:          walk.IconInformation(),
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		Size:          Size{Width: 400, Height: 180},
+		MinSize:       Size{Width: 400, Height: 180},
+		Layout:        VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: Grid{Columns: 2},
+				Children: []Widget{
+					Label{
+						Text: "DNS Names: ",
+					},
+					LineEdit{
+						AssignTo:    &dnsNames,
+						Text:        strings.Join(options.DNSNames, ","),
+						ToolTipText: "Optional extra names or addresses separated by comma, e.g. files.example.lan",
+					},
+					Label{
+						Text: "Key Type: ",
+					},
+					ComboBox{
+						AssignTo: &keyType,
+						CurrentIndex: func() int {
+							for i, item := range CertKeyOptions() {
+								if options.KeyType == item {
+									return i
+								}
+							}
+							return 0
+						},
+						Model:       CertKeyOptions(),
+						ToolTipText: "Most browsers do not accept ed25519 server certificates yet",
+					},
+					Label{
+						Text: "Validity Days: ",
+					},
+					NumberEdit{
+						AssignTo:    &days,
+						Value:       float64(options.Days),
+						ToolTipText: "1~3650 days",
+						MaxValue:    3650,
+						MinValue:    1,
+					},
+					Label{
+						Text: "Local CA: ",
+					},
+					CheckBox{
+						AssignTo:    &signByCA,
+						Text:        "Sign by local CA",
+						Checked:     options.SignByCA,
+						ToolTipText: "Issue from the CA kept in the config dir, trust its exported certificate once",
+					},
+				},
+			},
+			Composite{
+				Layout: HBox{},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "Generate",
+						OnClicked: func() {
+							options := CertOptions{
+								KeyType:  keyType.Text(),
+								DNSNames: CertNamesParse(dnsNames.Text()),
+								Days:     int64(days.Value()),
+								SignByCA: signByCA.Checked(),
+							}
+							var err error
+							cert, key, err = GenerateKeyCert(options)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							err = CertGenerateSave(options)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							dlg.Accept()
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &cancelPB,
+						Text:     "Cancel",
+						OnClicked: func() {
+							dlg.Cancel()
+						},
+					},
+					HSpacer{},
+				},
+			},
+		},
+	}.Run(owner)
+
+	if err != nil {
+		logs.Error(err.Error())
+		return "", "", false
+	}
+	return cert, key, cmd == walk.DlgCmdOK
+}
+
+// AcmeAction edits the acme directory and the domains of the certificate
+// used when the tls source is acme.
+func AcmeAction(owner walk.Form) {
+	var dlg *walk.Dialog
+	var acceptPB, cancelPB *walk.PushButton
+	var directoryURL, email, domains *walk.LineEdit
+	var directoryCA *walk.TextEdit
+	var challenge *walk.ComboBox
+	var httpPort *walk.NumberEdit
+
+	info := ConfigGet().AcmeInfo
+
+	_, err := Dialog{
+		AssignTo:      &dlg,
+		Title:         "ACME Certificate Edit",
+		Icon:          walk.IconInformation(),
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		Size:          Size{Width: 450, Height: 300},
+		MinSize:       Size{Width: 450, Height: 300},
+		Layout:        VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: Grid{Columns: 2},
+				Children: []Widget{
+					Label{
+						Text: "Directory URL: ",
+					},
+					LineEdit{
+						AssignTo:    &directoryURL,
+						Text:        info.DirectoryURL,
+						ToolTipText: "e.g. https://localhost:14000/dir of a local Pebble test server",
+					},
+					Label{
+						Text: "Directory CA: ",
+					},
+					TextEdit{
+						AssignTo:    &directoryCA,
+						MinSize:     Size{Height: 80},
+						Text:        info.DirectoryCA,
+						VScroll:     true,
+						ToolTipText: "Optional, the pem root of a private directory such as Pebble or step-ca",
+					},
+					Label{
+						Text: "Email: ",
+					},
+					LineEdit{
+						AssignTo: &email,
+						Text:     info.Email,
+					},
+					Label{
+						Text: "Domains*: ",
+					},
+					LineEdit{
+						AssignTo:    &domains,
+						Text:        strings.Join(info.Domains, ","),
+						ToolTipText: "Separated by comma, the first one names the cached certificate",
+					},
+					Label{
+						Text: "Challenge: ",
+					},
+					ComboBox{
+						AssignTo: &challenge,
+						CurrentIndex: func() int {
+							for i, item := range AcmeChallengeOptions() {
+								if info.Challenge == item {
+									return i
+								}
+							}
+							return 0
+						},
+						Model:       AcmeChallengeOptions(),
+						ToolTipText: "http-01 needs the http port below, tls-alpn-01 is answered on the server port",
+					},
+					Label{
+						Text: "HTTP Port: ",
+					},
+					NumberEdit{
+						AssignTo:    &httpPort,
+						Value:       float64(info.HttpPort),
+						ToolTipText: "1~65535, the validation always connects to port 80 unless a test server is told otherwise",
+						MaxValue:    65535,
+						MinValue:    1,
+					},
+				},
+			},
+			Composite{
+				Layout: HBox{},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "Save",
+						OnClicked: func() {
+							info := AcmeInfo{
+								DirectoryURL: strings.TrimSpace(directoryURL.Text()),
+								DirectoryCA:  directoryCA.Text(),
+								Email:        strings.TrimSpace(email.Text()),
+								Domains:      CertNamesParse(domains.Text()),
+								Challenge:    challenge.Text(),
+								HttpPort:     int64(httpPort.Value()),
+							}
+							err := AcmeInfoCheck(info)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							err = AcmeInfoSave(info)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							dlg.Accept()
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &cancelPB,
+						Text:     "Cancel",
+						OnClicked: func() {
+							dlg.Cancel()
+						},
+					},
+					HSpacer{},
+				},
+			},
+		},
+	}.Run(owner)
+
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+// TlsPolicyAction edits the protocol versions, cipher suites, alpn and the
+// per host certificates, they apply to every certificate source.
+func TlsPolicyAction(owner walk.Form) {
+	var dlg *walk.Dialog
+	var acceptPB, cancelPB *walk.PushButton
+	var minVersion *walk.ComboBox
+	var cipherSuites, alpn *walk.LineEdit
+	var sniCerts *walk.TextEdit
+
+	info := ConfigGet().HttpsInfo
+
+	_, err := Dialog{
+		AssignTo:      &dlg,
+		Title:         "TLS Policy Edit",
+		Icon:          walk.IconInformation(),
+		DefaultButton: &acceptPB,
+		CancelButton:  &cancelPB,
+		Size:          Size{Width: 450, Height: 300},
+		MinSize:       Size{Width: 450, Height: 300},
+		Layout:        VBox{},
+		Children: []Widget{
+			Composite{
+				Layout: Grid{Columns: 2},
+				Children: []Widget{
+					Label{
+						Text: "Min Version: ",
+					},
+					ComboBox{
+						AssignTo: &minVersion,
+						CurrentIndex: func() int {
+							for i, item := range TlsVersionOptions() {
+								if info.MinVersion == item {
+									return i
+								}
+							}
+							return 0
+						},
+						Model:       TlsVersionOptions(),
+						ToolTipText: "Oldest TLS version accepted, TLS 1.3 is always enabled",
+					},
+					Label{
+						Text: "Cipher Suites: ",
+					},
+					LineEdit{
+						AssignTo:    &cipherSuites,
+						Text:        info.CipherSuites,
+						ToolTipText: "default, modern, strict or suite names separated by comma, only used by TLS 1.2",
+					},
+					Label{
+						Text: "ALPN: ",
+					},
+					LineEdit{
+						AssignTo:    &alpn,
+						Text:        strings.Join(info.ALPN, ","),
+						ToolTipText: "Protocols offered in order separated by comma, e.g. h2,http/1.1",
+					},
+					Label{
+						Text: "SNI Certs: ",
+					},
+					TextEdit{
+						AssignTo:    &sniCerts,
+						MinSize:     Size{Height: 100},
+						Text:        SniCertsFormat(info.SniCerts),
+						VScroll:     true,
+						ToolTipText: "One host=cert file,key file per line, *.example.com matches one label",
+					},
+				},
+			},
+			Composite{
+				Layout: HBox{},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &acceptPB,
+						Text:     "Save",
+						OnClicked: func() {
+							protos, err := AlpnParse(alpn.Text())
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							certs, err := SniCertsParse(sniCerts.Text())
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+
+							info := ConfigGet().HttpsInfo
+							info.MinVersion = minVersion.Text()
+							info.CipherSuites = strings.TrimSpace(cipherSuites.Text())
+							info.ALPN = protos
+							info.SniCerts = certs
+
+							err = TlsInfoCheck(info)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							err = HttpsInfoSave(info)
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							dlg.Accept()
+						},
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &cancelPB,
+						Text:     "Cancel",
+						OnClicked: func() {
+							dlg.Cancel()
+						},
+					},
+					HSpacer{},
+				},
+			},
+		},
+	}.Run(owner)
+
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
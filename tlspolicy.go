@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	TlsVersion12 = "1.2"
+	TlsVersion13 = "1.3"
+
+	CipherProfileDefault = "default"
+	CipherProfileModern  = "modern"
+	CipherProfileStrict  = "strict"
+)
+
+func TlsVersionOptions() []string {
+	return []string{TlsVersion12, TlsVersion13}
+}
+
+func CipherProfileOptions() []string {
+	return []string{CipherProfileDefault, CipherProfileModern, CipherProfileStrict}
+}
+
+func AlpnOptions() []string {
+	return []string{"h2", "http/1.1"}
+}
+
+// cipherProfiles name the tls 1.2 suites of a profile, tls 1.3 suites are
+// not configurable and always secure.
+var cipherProfiles = map[string][]uint16{
+	CipherProfileModern: {
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	},
+	CipherProfileStrict: {
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	},
+}
+
+func tlsVersion(value string) (uint16, error) {
+	switch value {
+	case TlsVersion12, "":
+		return tls.VersionTLS12, nil
+	case TlsVersion13:
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported tls version %s, options are %s",
+		value, strings.Join(TlsVersionOptions(), ","))
+}
+
+// tlsCipherSuites resolves a profile name or a comma separated list of
+// suite names as printed by crypto/tls, nil keeps the go defaults.
+func tlsCipherSuites(value string) ([]uint16, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == CipherProfileDefault {
+		return nil, nil
+	}
+	if suites, ok := cipherProfiles[value]; ok {
+		return suites, nil
+	}
+
+	output := make([]uint16, 0)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var found bool
+		for _, suite := range tls.CipherSuites() {
+			if suite.Name == name {
+				output = append(output, suite.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %s, profiles are %s",
+				name, strings.Join(CipherProfileOptions(), ","))
+		}
+	}
+	return output, nil
+}
+
+func AlpnParse(value string) ([]string, error) {
+	output := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !permissionHas(AlpnOptions(), item) {
+			return nil, fmt.Errorf("unsupported alpn protocol %s, options are %s",
+				item, strings.Join(AlpnOptions(), ","))
+		}
+		if !permissionHas(output, item) {
+			output = append(output, item)
+		}
+	}
+	return output, nil
+}
+
+// http2CipherCheck mirrors the check of net/http, a tls 1.2 suite list
+// without an aes 128 gcm suite fails when http/2 is offered.
+func http2CipherCheck(suites []uint16, minVersion uint16) error {
+	if suites == nil || minVersion >= tls.VersionTLS13 {
+		return nil
+	}
+	for _, suite := range suites {
+		if suite == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 ||
+			suite == tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+			return nil
+		}
+	}
+	return fmt.Errorf("h2 needs TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 when tls 1.2 is allowed")
+}
+
+// httpsAlpn picks the protocols offered on the https listener, h2 leads
+// when the alpn is not configured and is dropped when http/2 is off or the
+// cipher suites do not allow it.
+func httpsAlpn(info TlsInfo, http2 bool) []string {
+	protos := info.ALPN
+	if len(protos) == 0 {
+		protos = []string{"h2", "http/1.1"}
+	}
+	if http2 {
+		minVersion, _ := tlsVersion(info.MinVersion)
+		suites, _ := tlsCipherSuites(info.CipherSuites)
+		if err := http2CipherCheck(suites, minVersion); err != nil {
+			logs.Warning("http/2 disabled on https, %s", err.Error())
+			http2 = false
+		}
+	}
+	output := make([]string, 0, len(protos))
+	for _, proto := range protos {
+		if proto == "h2" && !http2 {
+			continue
+		}
+		output = append(output, proto)
+	}
+	if len(output) == 0 {
+		output = append(output, "http/1.1")
+	}
+	return output
+}
+
+// SniCertsFormat renders one "host=cert file,key file" per line
+func SniCertsFormat(certs []SniCert) string {
+	items := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		items = append(items, fmt.Sprintf("%s=%s,%s", cert.Host, cert.CertFile, cert.KeyFile))
+	}
+	return strings.Join(items, "\r\n")
+}
+
+func SniCertsParse(value string) ([]SniCert, error) {
+	output := make([]SniCert, 0)
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		host, files, found := strings.Cut(line, "=")
+		certFile, keyFile, found2 := strings.Cut(files, ",")
+		if !found || !found2 {
+			return nil, fmt.Errorf("sni certificate %s must look like host=cert.pem,key.pem", line)
+		}
+		output = append(output, SniCert{
+			Host:     strings.ToLower(strings.TrimSpace(host)),
+			CertFile: strings.TrimSpace(certFile),
+			KeyFile:  strings.TrimSpace(keyFile),
+		})
+	}
+	return output, nil
+}
+
+// TlsInfoCheck validates the tls policy when it is saved
+func TlsInfoCheck(info TlsInfo) error {
+	minVersion, err := tlsVersion(info.MinVersion)
+	if err != nil {
+		return err
+	}
+	suites, err := tlsCipherSuites(info.CipherSuites)
+	if err != nil {
+		return err
+	}
+	for _, proto := range info.ALPN {
+		if !permissionHas(AlpnOptions(), proto) {
+			return fmt.Errorf("unsupported alpn protocol %s", proto)
+		}
+	}
+	if permissionHas(info.ALPN, "h2") {
+		if err := http2CipherCheck(suites, minVersion); err != nil {
+			return err
+		}
+	}
+	for _, sni := range info.SniCerts {
+		if sni.Host == "" {
+			return fmt.Errorf("sni certificate %s without host name", sni.CertFile)
+		}
+		if _, err := tls.LoadX509KeyPair(sni.CertFile, sni.KeyFile); err != nil {
+			return fmt.Errorf("sni certificate of %s, %s", sni.Host, err.Error())
+		}
+	}
+	return nil
+}
+
+// sniCertificates serves the certificate configured for a host name, the
+// files are watched like the main certificate files.
+type sniCertificates struct {
+	hosts map[string]*certFileWatcher
+}
+
+func newSniCertificates(certs []SniCert) (*sniCertificates, error) {
+	s := &sniCertificates{hosts: make(map[string]*certFileWatcher)}
+	for _, cert := range certs {
+		watcher, err := newCertFileWatcher(cert.CertFile, cert.KeyFile)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("sni certificate of %s, %s", cert.Host, err.Error())
+		}
+		s.hosts[strings.ToLower(cert.Host)] = watcher
+	}
+	return s, nil
+}
+
+// match looks the server name up, "*.example.com" covers one label
+func (s *sniCertificates) match(serverName string) *tls.Certificate {
+	for _, pattern := range hostPatterns(hostName(serverName)) {
+		if watcher, ok := s.hosts[pattern]; ok {
+			return watcher.Certificate()
+		}
+	}
+	return nil
+}
+
+// Apply puts the sni certificates in front of the certificate source of
+// config, acme validation requests always go to the source.
+func (s *sniCertificates) Apply(config *tls.Config) {
+	if len(s.hosts) == 0 {
+		return
+	}
+	fallback := config.GetCertificate
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if !permissionHas(hello.SupportedProtos, acmeTlsAlpnProto) {
+			if cert := s.match(hello.ServerName); cert != nil {
+				return cert, nil
+			}
+		}
+		if fallback != nil {
+			return fallback(hello)
+		}
+		// nil lets crypto/tls pick from config.Certificates
+		return nil, nil
+	}
+}
+
+func (s *sniCertificates) Start() {
+	for _, watcher := range s.hosts {
+		watcher.Start()
+	}
+}
+
+func (s *sniCertificates) Close() {
+	for _, watcher := range s.hosts {
+		watcher.Close()
+	}
+}
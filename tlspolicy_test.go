@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTlsPolicyParse(t *testing.T) {
+	if v, err := tlsVersion(""); err != nil || v != tls.VersionTLS12 {
+		t.Errorf("tlsVersion(\"\") = %x, %v", v, err)
+	}
+	if v, err := tlsVersion(TlsVersion13); err != nil || v != tls.VersionTLS13 {
+		t.Errorf("tlsVersion(1.3) = %x, %v", v, err)
+	}
+	if _, err := tlsVersion("1.0"); err == nil {
+		t.Error("tlsVersion(1.0) succeeded")
+	}
+
+	if suites, err := tlsCipherSuites(CipherProfileDefault); err != nil || suites != nil {
+		t.Errorf("default profile = %v, %v", suites, err)
+	}
+	if suites, err := tlsCipherSuites(CipherProfileStrict); err != nil || len(suites) != 4 {
+		t.Errorf("strict profile = %v, %v", suites, err)
+	}
+	suites, err := tlsCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, ")
+	if err != nil || len(suites) != 1 || suites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("named suite = %v, %v", suites, err)
+	}
+	if _, err := tlsCipherSuites("TLS_RSA_WITH_RC4_128_SHA"); err == nil {
+		t.Error("insecure suite was accepted")
+	}
+
+	alpn, err := AlpnParse("h2, http/1.1, h2")
+	if err != nil || len(alpn) != 2 || alpn[0] != "h2" {
+		t.Errorf("AlpnParse = %v, %v", alpn, err)
+	}
+	if _, err := AlpnParse("spdy/3"); err == nil {
+		t.Error("AlpnParse accepted spdy/3")
+	}
+
+	certs, err := SniCertsParse("A.Example.com = a.crt , a.key\r\n\r\n*.example.org=b.crt,b.key\r\n")
+	if err != nil || len(certs) != 2 {
+		t.Fatalf("SniCertsParse = %v, %v", certs, err)
+	}
+	if certs[0] != (SniCert{Host: "a.example.com", CertFile: "a.crt", KeyFile: "a.key"}) {
+		t.Errorf("first sni cert = %+v", certs[0])
+	}
+	again, err := SniCertsParse(SniCertsFormat(certs))
+	if err != nil || len(again) != 2 || again[1] != certs[1] {
+		t.Errorf("format round trip = %v, %v", again, err)
+	}
+	if _, err := SniCertsParse("a.example.com=a.crt"); err == nil {
+		t.Error("SniCertsParse without a key file succeeded")
+	}
+}
+
+func TestSniCertificates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) SniCert {
+		certPEM, keyPEM, err := GenerateKeyCert(CertOptions{KeyType: CertKeyEcdsa, DNSNames: []string{name}, Days: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, filepath.Base(name))
+		if err := os.WriteFile(file+".crt", []byte(certPEM), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file+".key", []byte(keyPEM), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return SniCert{Host: name, CertFile: file + ".crt", KeyFile: file + ".key"}
+	}
+	exact := write("app.example.com")
+	wildcard := write("*.example.org")
+	if err := TlsInfoCheck(TlsInfo{SniCerts: []SniCert{exact, wildcard}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := TlsInfoCheck(TlsInfo{SniCerts: []SniCert{{Host: "x.test", CertFile: "missing.crt", KeyFile: "missing.key"}}}); err == nil {
+		t.Error("TlsInfoCheck with missing files succeeded")
+	}
+
+	sni, err := newSniCertificates([]SniCert{exact, wildcard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sni.Close()
+
+	fallback := &tls.Certificate{}
+	config := &tls.Config{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return fallback, nil
+	}}
+	sni.Apply(config)
+
+	tests := []struct {
+		hello *tls.ClientHelloInfo
+		name  string
+	}{
+		{&tls.ClientHelloInfo{ServerName: "APP.example.com."}, "app.example.com"},
+		{&tls.ClientHelloInfo{ServerName: "www.example.org"}, "www.example.org"},
+		{&tls.ClientHelloInfo{ServerName: "a.b.example.org"}, ""},
+		{&tls.ClientHelloInfo{ServerName: "other.test"}, ""},
+		{&tls.ClientHelloInfo{ServerName: "app.example.com", SupportedProtos: []string{acmeTlsAlpnProto}}, ""},
+	}
+	for _, tt := range tests {
+		cert, err := config.GetCertificate(tt.hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.name == "" {
+			if cert != fallback {
+				t.Errorf("%s got an sni certificate, want the fallback", tt.hello.ServerName)
+			}
+			continue
+		}
+		if cert == fallback || cert.Leaf.VerifyHostname(tt.name) != nil {
+			t.Errorf("%s did not get its sni certificate", tt.hello.ServerName)
+		}
+	}
+}
+
+func TestHttpsAlpn(t *testing.T) {
+	tests := []struct {
+		info  TlsInfo
+		http2 bool
+		want  string
+	}{
+		{TlsInfo{}, true, "h2,http/1.1"},
+		{TlsInfo{}, false, "http/1.1"},
+		{TlsInfo{ALPN: []string{"http/1.1", "h2"}}, true, "http/1.1,h2"},
+		{TlsInfo{ALPN: []string{"h2"}}, false, "http/1.1"},
+		{TlsInfo{CipherSuites: CipherProfileStrict}, true, "http/1.1"},
+		{TlsInfo{CipherSuites: CipherProfileStrict, MinVersion: TlsVersion13}, true, "h2,http/1.1"},
+		{TlsInfo{CipherSuites: CipherProfileModern}, true, "h2,http/1.1"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(httpsAlpn(tt.info, tt.http2), ","); got != tt.want {
+			t.Errorf("httpsAlpn(%+v, %v) = %s, want %s", tt.info, tt.http2, got, tt.want)
+		}
+	}
+
+	if err := TlsInfoCheck(TlsInfo{CipherSuites: CipherProfileStrict, ALPN: []string{"h2"}}); err == nil {
+		t.Error("TlsInfoCheck allowed h2 without an aes 128 gcm suite")
+	}
+	if err := TlsInfoCheck(TlsInfo{CipherSuites: CipherProfileStrict, ALPN: []string{"http/1.1"}}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtension   = "creation,termination,checksum"
+	tusChecksums   = "sha1,sha256"
+	tusContentType = "application/offset+octet-stream"
+
+	// tusChecksumMismatch is the status defined by the checksum extension
+	tusChecksumMismatch = 460
+)
+
+// tusUpload is kept in the stage folder as "id.info", User is the name of
+// the user who created it, empty without auth.
+type tusUpload struct {
+	ID       string
+	Dir      string
+	FileName string
+	Length   int64
+	Created  time.Time
+	User     string
+}
+
+// tusUploads serializes PATCH requests per upload id, a client retrying
+// after a timeout must not append to the file while the old request runs.
+type tusUploads struct {
+	sync.Mutex
+	busy map[string]bool
+}
+
+func newTusUploads() *tusUploads {
+	return &tusUploads{busy: make(map[string]bool)}
+}
+
+func (t *tusUploads) Acquire(id string) bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.busy[id] {
+		return false
+	}
+	t.busy[id] = true
+	return true
+}
+
+func (t *tusUploads) Release(id string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.busy, id)
+}
+
+func tusRequest(r *http.Request) bool {
+	return r.Header.Get("Tus-Resumable") != ""
+}
+
+func tusMetadata(value string) map[string]string {
+	output := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		items := strings.Fields(pair)
+		if len(items) == 0 {
+			continue
+		}
+		if len(items) == 1 {
+			output[items[0]] = ""
+			continue
+		}
+		body, err := base64.StdEncoding.DecodeString(items[1])
+		if err != nil {
+			continue
+		}
+		output[items[0]] = string(body)
+	}
+	return output
+}
+
+// tusChecksum parses the "algorithm base64" value of Upload-Checksum
+func tusChecksum(value string) (*uploadDigest, error) {
+	if value == "" {
+		return nil, nil
+	}
+	algorithm, digest, _ := strings.Cut(value, " ")
+	var h hash.Hash
+	switch algorithm {
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %s", algorithm)
+	}
+	want, err := base64.StdEncoding.DecodeString(digest)
+	if err != nil || len(want) != h.Size() {
+		return nil, fmt.Errorf("invalid checksum %s", value)
+	}
+	return &uploadDigest{Hash: h, want: want}, nil
+}
+
+func tusUser(r *http.Request) string {
+	if user := authUserGet(r); user != nil {
+		return user.UserName
+	}
+	return ""
+}
+
+// tusPermit checks a request on the stage path of an upload, only the user
+// who created it may go on, with the upload permission of the target folder.
+func (f *fileHandler) tusPermit(r *http.Request, upload *tusUpload) bool {
+	return upload.User == tusUser(r) && f.permit(r, upload.Dir, PermUpload)
+}
+
+func (f *fileHandler) tusInfoPath(id string) string {
+	return filepath.Join(f.uploadStageGet(), id+".info")
+}
+
+func (f *fileHandler) tusPartPath(id string) string {
+	return filepath.Join(f.uploadStageGet(), id+".part")
+}
+
+func (f *fileHandler) tusLoad(urlPath string) (*tusUpload, error) {
+	id := path.Base(urlPath)
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 32 {
+		return nil, os.ErrNotExist
+	}
+	value, err := os.ReadFile(f.tusInfoPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var upload tusUpload
+	err = json.Unmarshal(value, &upload)
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (f *fileHandler) tusOffset(upload *tusUpload) (int64, error) {
+	stat, err := os.Stat(f.tusPartPath(upload.ID))
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func (f *fileHandler) tusRemove(upload *tusUpload) error {
+	os.Remove(f.tusPartPath(upload.ID))
+	return os.Remove(f.tusInfoPath(upload.ID))
+}
+
+func (f *fileHandler) tusFinish(upload *tusUpload) error {
+	outPath, conflict, err := uploadTarget(f.osPathGet(upload.Dir), upload.FileName, f.uploadConflict)
+	if err != nil {
+		logs.Warning("http server resumable upload %s %s, %s", upload.ID, conflict, err.Error())
+		f.tusRemove(upload)
+		return err
+	}
+	err = os.Rename(f.tusPartPath(upload.ID), outPath)
+	if err != nil {
+		return err
+	}
+	os.Remove(f.tusInfoPath(upload.ID))
+	logs.Info("http server resumable upload %s finished, %s %s", upload.ID, outPath, conflict)
+	return nil
+}
+
+func (f *fileHandler) serveTusOptions(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtension)
+	w.Header().Set("Tus-Checksum-Algorithm", tusChecksums)
+	if f.allowWebdav {
+		return f.serveDavOptions(w, r)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (f *fileHandler) serveTusCreate(w http.ResponseWriter, r *http.Request, osPath string) error {
+	info, err := os.Stat(osPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return f.serveStatus(w, r, http.StatusConflict)
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	}
+
+	name := filepath.Base(tusMetadata(r.Header.Get("Upload-Metadata"))["filename"])
+	if name == "." || name == ".." || name == osPathSeparator || name == uploadStageDir {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	}
+
+	// refuse early instead of after the whole file was transferred
+	_, _, err = uploadTarget(osPath, name, f.uploadConflict)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+
+	upload := &tusUpload{
+		ID:       hex.EncodeToString(buf),
+		Dir:      path.Clean("/" + r.URL.Path),
+		FileName: name,
+		Length:   length,
+		Created:  time.Now(),
+		User:     tusUser(r),
+	}
+
+	if err := os.MkdirAll(f.uploadStageGet(), 0755); err != nil {
+		return err
+	}
+	value, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(f.tusInfoPath(upload.ID), value, 0644); err != nil {
+		return err
+	}
+	part, err := os.OpenFile(f.tusPartPath(upload.ID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	part.Close()
+
+	logs.Info("http server resumable upload %s created, %s/%s %d bytes",
+		upload.ID, upload.Dir, upload.FileName, upload.Length)
+
+	if length == 0 {
+		if err := f.tusFinish(upload); err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Location", path.Join(f.route, uploadStageDir, upload.ID))
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (f *fileHandler) serveTusHead(w http.ResponseWriter, r *http.Request) error {
+	upload, err := f.tusLoad(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	if !f.tusPermit(r, upload) {
+		return f.serveStatus(w, r, http.StatusForbidden)
+	}
+	offset, err := f.tusOffset(upload)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (f *fileHandler) serveTusPatch(w http.ResponseWriter, r *http.Request) error {
+	if r.Header.Get("Content-Type") != tusContentType {
+		return f.serveStatus(w, r, http.StatusUnsupportedMediaType)
+	}
+	upload, err := f.tusLoad(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	if !f.tusPermit(r, upload) {
+		return f.serveStatus(w, r, http.StatusForbidden)
+	}
+
+	if !f.uploads.Acquire(upload.ID) {
+		return f.serveStatus(w, r, http.StatusLocked)
+	}
+	defer f.uploads.Release(upload.ID)
+
+	offset, err := f.tusOffset(upload)
+	if err != nil {
+		return err
+	}
+	if r.Header.Get("Upload-Offset") != strconv.FormatInt(offset, 10) {
+		return f.serveStatus(w, r, http.StatusConflict)
+	}
+
+	digest, err := tusChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	}
+
+	part, err := os.OpenFile(f.tusPartPath(upload.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = part
+	if digest != nil {
+		out = io.MultiWriter(part, digest)
+	}
+	// keep whatever arrived before a broken connection, the client resumes
+	// from the offset reported by the next HEAD request. A chunk with a
+	// checksum is kept only as a whole.
+	cnt, copyErr := io.Copy(out, io.LimitReader(r.Body, upload.Length-offset))
+	err = part.Close()
+	if err != nil {
+		return err
+	}
+	if digest != nil && (copyErr != nil || digest.Verify() != nil) {
+		if err := os.Truncate(f.tusPartPath(upload.ID), offset); err != nil {
+			return err
+		}
+		if copyErr == nil {
+			w.WriteHeader(tusChecksumMismatch)
+			_, err = w.Write([]byte("Checksum Mismatch"))
+			return err
+		}
+	}
+	if copyErr != nil {
+		logs.Warning("http server resumable upload %s interrupted at %d, %s",
+			upload.ID, offset+cnt, copyErr.Error())
+		return copyErr
+	}
+
+	offset += cnt
+	if offset == upload.Length {
+		if err := f.tusFinish(upload); err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (f *fileHandler) serveTusDelete(w http.ResponseWriter, r *http.Request) error {
+	upload, err := f.tusLoad(r.URL.Path)
+	if err != nil {
+		return err
+	}
+	if !f.tusPermit(r, upload) {
+		return f.serveStatus(w, r, http.StatusForbidden)
+	}
+	if !f.uploads.Acquire(upload.ID) {
+		return f.serveStatus(w, r, http.StatusLocked)
+	}
+	defer f.uploads.Release(upload.ID)
+
+	if err := f.tusRemove(upload); err != nil {
+		return err
+	}
+	logs.Info("http server resumable upload %s terminated", upload.ID)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// serveTus implements the tus 1.0 core protocol with the creation and
+// termination extensions, uploads are created by a POST to the target folder.
+func (f *fileHandler) serveTus(w http.ResponseWriter, r *http.Request, osPath string) error {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		return f.serveTusOptions(w, r)
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		return f.serveStatus(w, r, http.StatusPreconditionFailed)
+	}
+
+	stage := uploadStagePath(f.mountPath(r.URL.Path))
+	switch {
+	case r.Method == http.MethodPost && !stage:
+		return f.serveTusCreate(w, r, osPath)
+	case r.Method == http.MethodHead && stage:
+		return f.serveTusHead(w, r)
+	case r.Method == http.MethodPatch && stage:
+		return f.serveTusPatch(w, r)
+	case r.Method == http.MethodDelete && stage:
+		return f.serveTusDelete(w, r)
+	}
+	return f.serveStatus(w, r, http.StatusMethodNotAllowed)
+}
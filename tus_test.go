@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTusMetadata(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]string
+	}{
+		{"", map[string]string{}},
+		{"filename aGVsbG8udHh0", map[string]string{"filename": "hello.txt"}},
+		{"filename aGVsbG8udHh0,is_confidential", map[string]string{"filename": "hello.txt", "is_confidential": ""}},
+		{" filename  aGVsbG8udHh0 , type dGV4dC9wbGFpbg== ", map[string]string{"filename": "hello.txt", "type": "text/plain"}},
+		{"filename !!!,type dGV4dC9wbGFpbg==", map[string]string{"type": "text/plain"}},
+		{",,", map[string]string{}},
+	}
+	for _, test := range tests {
+		got := tusMetadata(test.value)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("tusMetadata(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestTusUpload(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := &fileHandler{route: "/", path: dir, allowUpload: true, uploads: newTusUploads()}
+	tus := map[string]string{"Tus-Resumable": tusVersion}
+
+	w := testServe(t, f, http.MethodOptions, "/sub/", "", nil)
+	if w.Header().Get("Tus-Version") != tusVersion || !strings.Contains(w.Header().Get("Tus-Extension"), "creation") {
+		t.Fatalf("OPTIONS headers = %v", w.Header())
+	}
+
+	w = testServe(t, f, http.MethodPost, "/sub/", "", map[string]string{
+		"Tus-Resumable":   tusVersion,
+		"Upload-Length":   "11",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("hello.txt")),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST = %d, want %d", w.Code, http.StatusCreated)
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/"+uploadStageDir+"/") {
+		t.Fatalf("POST Location = %q", location)
+	}
+
+	patch := func(offset, body string) *httptest.ResponseRecorder {
+		return testServe(t, f, http.MethodPatch, location, body, map[string]string{
+			"Tus-Resumable": tusVersion,
+			"Content-Type":  tusContentType,
+			"Upload-Offset": offset,
+		})
+	}
+	if w := patch("0", "hello "); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "6" {
+		t.Fatalf("first PATCH = %d offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w := patch("0", "world"); w.Code != http.StatusConflict {
+		t.Errorf("PATCH at a stale offset = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := testServe(t, f, http.MethodHead, location, "", tus); w.Code != http.StatusOK ||
+		w.Header().Get("Upload-Offset") != "6" || w.Header().Get("Upload-Length") != "11" {
+		t.Errorf("HEAD = %d %v", w.Code, w.Header())
+	}
+	if w := testServe(t, f, http.MethodGet, location, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET of the stage path = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := testServe(t, f, http.MethodGet, "/", "", nil); strings.Contains(w.Body.String(), uploadStageDir) {
+		t.Errorf("the listing shows the stage folder")
+	}
+	if w := patch("6", "world and more"); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("last PATCH = %d offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	body, err := os.ReadFile(filepath.Join(dir, "sub", "hello.txt"))
+	if err != nil || string(body) != "hello world" {
+		t.Fatalf("uploaded file = %q, %v", body, err)
+	}
+	if w := testServe(t, f, http.MethodHead, location, "", tus); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD of a finished upload = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTusTerminate(t *testing.T) {
+	f := &fileHandler{route: "/", path: t.TempDir(), allowUpload: true, uploads: newTusUploads()}
+	tus := map[string]string{"Tus-Resumable": tusVersion}
+
+	if w := testServe(t, f, http.MethodPost, "/", "", map[string]string{"Upload-Length": "5"}); w.Code == http.StatusCreated {
+		t.Fatalf("POST without Tus-Resumable created an upload")
+	}
+	if w := testServe(t, f, http.MethodPost, "/", "", map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "5"}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("POST of another version = %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	w := testServe(t, f, http.MethodPost, "/", "", map[string]string{
+		"Tus-Resumable":   tusVersion,
+		"Upload-Length":   "5",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("../../x.txt")),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST = %d, want %d", w.Code, http.StatusCreated)
+	}
+	location := w.Header().Get("Location")
+	if w := testServe(t, f, http.MethodDelete, location, "", tus); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if w := testServe(t, f, http.MethodHead, location, "", tus); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD after DELETE = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTusChecksum(t *testing.T) {
+	body := []byte("hello")
+	sum1 := sha1.Sum(body)
+	sum256 := sha256.Sum256(body)
+	sha1Value := "sha1 " + base64.StdEncoding.EncodeToString(sum1[:])
+	sha256Value := "sha256 " + base64.StdEncoding.EncodeToString(sum256[:])
+
+	tests := []struct {
+		value  string
+		body   string
+		digest bool
+		err    bool
+		verify error
+	}{
+		{"", "hello", false, false, nil},
+		{sha1Value, "hello", true, false, nil},
+		{sha256Value, "hello", true, false, nil},
+		{sha256Value, "hellO", true, false, errUploadChecksum},
+		{"md5 XUFAKrxLKna5cZ2REBfFkg==", "hello", false, true, nil},
+		{"sha256 !!!", "hello", false, true, nil},
+		{"sha256 " + base64.StdEncoding.EncodeToString(sum1[:]), "hello", false, true, nil},
+		{"sha256", "hello", false, true, nil},
+	}
+	for _, test := range tests {
+		digest, err := tusChecksum(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("tusChecksum(%q) error = %v, want error %v", test.value, err, test.err)
+			continue
+		}
+		if (digest != nil) != test.digest {
+			t.Errorf("tusChecksum(%q) digest = %v, want digest %v", test.value, digest != nil, test.digest)
+			continue
+		}
+		if digest == nil {
+			continue
+		}
+		digest.Write([]byte(test.body))
+		if err := digest.Verify(); !errors.Is(err, test.verify) {
+			t.Errorf("tusChecksum(%q) verify %q = %v, want %v", test.value, test.body, err, test.verify)
+		}
+	}
+}
+
+func TestTusPatchChecksum(t *testing.T) {
+	dir := t.TempDir()
+	f := &fileHandler{route: "/", path: dir, allowUpload: true, uploads: newTusUploads()}
+
+	w := testServe(t, f, http.MethodPost, "/", "", map[string]string{
+		"Tus-Resumable":   tusVersion,
+		"Upload-Length":   "5",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt")),
+	})
+	location := w.Header().Get("Location")
+	patch := func(body, checksum string) *httptest.ResponseRecorder {
+		return testServe(t, f, http.MethodPatch, location, body, map[string]string{
+			"Tus-Resumable":   tusVersion,
+			"Content-Type":    tusContentType,
+			"Upload-Offset":   "0",
+			"Upload-Checksum": checksum,
+		})
+	}
+
+	sum := sha1.Sum([]byte("hello"))
+	if w := patch("hellO", "sha1 "+base64.StdEncoding.EncodeToString(sum[:])); w.Code != tusChecksumMismatch {
+		t.Fatalf("PATCH with a wrong checksum = %d, want %d", w.Code, tusChecksumMismatch)
+	}
+	if w := testServe(t, f, http.MethodHead, location, "", map[string]string{"Tus-Resumable": tusVersion}); w.Header().Get("Upload-Offset") != "0" {
+		t.Fatalf("offset after a checksum mismatch = %q, want 0", w.Header().Get("Upload-Offset"))
+	}
+	if w := patch("hello", "md5 XUFAKrxLKna5cZ2REBfFkg=="); w.Code != http.StatusBadRequest {
+		t.Errorf("PATCH with an unsupported algorithm = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := patch("hello", "sha1 "+base64.StdEncoding.EncodeToString(sum[:])); w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH with the checksum = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if body, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(body) != "hello" {
+		t.Errorf("uploaded file = %q, %v", body, err)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	uploadFormName     = "file"
+	uploadChecksumName = "sha256"
+
+	// uploadStageDir is the hidden folder under the server dir which keeps
+	// unfinished uploads, so finishing one is a rename on the same disk.
+	uploadStageDir = ".upload-stage"
+
+	// uploadExpire is how long an untouched unfinished upload is kept
+	uploadExpire = 7 * 24 * time.Hour
+)
+
+const (
+	UploadConflictOverwrite = "overwrite"
+	UploadConflictRename    = "rename"
+	UploadConflictReject    = "reject"
+)
+
+var errUploadConflict = errors.New("file already exists")
+var errUploadChecksum = errors.New("checksum mismatch")
+var errUploadRequest = errors.New("malformed upload")
+
+func UploadConflictOptions() []string {
+	return []string{UploadConflictOverwrite, UploadConflictRename, UploadConflictReject}
+}
+
+type uploadResult struct {
+	Name     string `json:"name"`
+	SavedAs  string `json:"saved_as,omitempty"`
+	Size     int64  `json:"size"`
+	Conflict string `json:"conflict,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	status int
+}
+
+// uploadDigest checks the bytes written to it against the digest the
+// client sent along with the upload.
+type uploadDigest struct {
+	hash.Hash
+	want []byte
+}
+
+func (d *uploadDigest) Verify() error {
+	if !bytes.Equal(d.Sum(nil), d.want) {
+		return errUploadChecksum
+	}
+	return nil
+}
+
+type uploadBody struct {
+	io.Reader
+	io.Closer
+}
+
+// uploadContentDigest parses a RFC 9530 Content-Digest header, it returns
+// nil when the header carries no algorithm we are able to check.
+func uploadContentDigest(value string) (*uploadDigest, error) {
+	for _, item := range strings.Split(value, ",") {
+		key, digest, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			continue
+		}
+		var h hash.Hash
+		switch strings.ToLower(key) {
+		case "sha-256":
+			h = sha256.New()
+		case "sha-512":
+			h = sha512.New()
+		default:
+			continue
+		}
+		want, err := base64.StdEncoding.DecodeString(strings.Trim(digest, ":"))
+		if err != nil || len(want) != h.Size() {
+			return nil, fmt.Errorf("%w, invalid content digest %q", errUploadChecksum, item)
+		}
+		return &uploadDigest{Hash: h, want: want}, nil
+	}
+	return nil, nil
+}
+
+// uploadSha256 parses the hex sha256 of X-Checksum-SHA256 or the form field
+func uploadSha256(value string) (*uploadDigest, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	want, err := hex.DecodeString(value)
+	if err != nil || len(want) != sha256.Size {
+		return nil, fmt.Errorf("%w, invalid sha256 %q", errUploadChecksum, value)
+	}
+	return &uploadDigest{Hash: sha256.New(), want: want}, nil
+}
+
+// uploadStagePath reports whether the url path points into the stage folder
+func uploadStagePath(urlPath string) bool {
+	urlPath = path.Clean("/" + urlPath)
+	return urlPath == "/"+uploadStageDir || strings.HasPrefix(urlPath, "/"+uploadStageDir+"/")
+}
+
+func uploadStageHide(files []os.FileInfo) []os.FileInfo {
+	output := make([]os.FileInfo, 0, len(files))
+	for _, file := range files {
+		if file.Name() != uploadStageDir {
+			output = append(output, file)
+		}
+	}
+	return output
+}
+
+func (f *fileHandler) uploadStageGet() string {
+	return filepath.Join(f.path, uploadStageDir)
+}
+
+// uploadCleanup removes what interrupted uploads left in the stage folder
+func (f *fileHandler) uploadCleanup(maxAge time.Duration) {
+	files, err := os.ReadDir(f.uploadStageGet())
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		switch filepath.Ext(file.Name()) {
+		case ".upload":
+			os.Remove(filepath.Join(f.uploadStageGet(), file.Name()))
+			logs.Info("http server upload temp file %s expired", file.Name())
+		case ".info":
+			id := strings.TrimSuffix(file.Name(), ".info")
+			if stat, err := os.Stat(f.tusPartPath(id)); err == nil && time.Since(stat.ModTime()) < maxAge {
+				continue
+			}
+			os.Remove(f.tusPartPath(id))
+			os.Remove(f.tusInfoPath(id))
+			logs.Info("http server resumable upload %s expired", id)
+		}
+	}
+}
+
+// uploadTarget resolves the file an upload named name is written to under
+// the conflict policy, for rename it is the first free "name (n).ext".
+func uploadTarget(dir, name, policy string) (string, string, error) {
+	outPath := filepath.Join(dir, name)
+	_, err := os.Stat(outPath)
+	if os.IsNotExist(err) {
+		return outPath, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	switch policy {
+	case UploadConflictRename:
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for i := 1; ; i++ {
+			outPath = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+			_, err := os.Stat(outPath)
+			if os.IsNotExist(err) {
+				return outPath, "renamed", nil
+			}
+			if err != nil {
+				return "", "", err
+			}
+		}
+	case UploadConflictReject:
+		return "", "rejected", errUploadConflict
+	}
+	return outPath, "overwritten", nil
+}
+
+// uploadStatus is the status of the first file which failed because of
+// the client, a rejected conflict or a checksum mismatch.
+func uploadStatus(results []uploadResult) int {
+	for _, result := range results {
+		if result.status != 0 {
+			return result.status
+		}
+	}
+	return http.StatusOK
+}
+
+func uploadFail(result *uploadResult, err error) {
+	result.Error = err.Error()
+	switch {
+	case errors.Is(err, errUploadConflict):
+		result.status = http.StatusConflict
+	case errors.Is(err, errUploadChecksum):
+		result.Conflict = ""
+		result.status = http.StatusBadRequest
+	default:
+		result.Conflict = ""
+	}
+}
+
+func uploadAcceptJson(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// uploadWrite copies an upload into a new temp file in the stage folder and
+// verifies the digest when there is one, the temp file is gone on error.
+func (f *fileHandler) uploadWrite(in io.Reader, result *uploadResult, digest *uploadDigest) (string, error) {
+	err := os.MkdirAll(f.uploadStageGet(), 0755)
+	if err != nil {
+		return "", err
+	}
+	temp, err := os.CreateTemp(f.uploadStageGet(), "*.upload")
+	if err != nil {
+		return "", err
+	}
+
+	var out io.Writer = temp
+	if digest != nil {
+		out = io.MultiWriter(temp, digest)
+	}
+	result.Size, err = io.Copy(out, in)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && digest != nil {
+		err = digest.Verify()
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return "", err
+	}
+	return temp.Name(), nil
+}
+
+// uploadCommit renames a finished temp file into the folder
+func (f *fileHandler) uploadCommit(tempPath, osPath string, result *uploadResult) error {
+	outPath, conflict, err := uploadTarget(osPath, result.Name, f.uploadConflict)
+	result.Conflict = conflict
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tempPath, outPath)
+	if err != nil {
+		return err
+	}
+	result.SavedAs = filepath.Base(outPath)
+	return nil
+}
+
+// serveUploadTo streams every "file" part of the multipart body into the
+// stage folder, nothing is spooled to the temp directory of the system.
+// A "sha256" field checks the file part following it, X-Checksum-SHA256
+// every file part and Content-Digest the whole body. Files are renamed
+// into the folder once the whole body was received and verified.
+func (f *fileHandler) serveUploadTo(w http.ResponseWriter, r *http.Request, osPath string) error {
+	bodyDigest, err := uploadContentDigest(r.Header.Get("Content-Digest"))
+	if err != nil {
+		return err
+	}
+	if bodyDigest != nil {
+		r.Body = uploadBody{Reader: io.TeeReader(r.Body, bodyDigest), Closer: r.Body}
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return fmt.Errorf("%w, %s", errUploadRequest, err.Error())
+	}
+
+	temps := make(map[int]string)
+	defer func() {
+		for _, temp := range temps {
+			os.Remove(temp)
+		}
+	}()
+
+	var checksum string
+	results := make([]uploadResult, 0)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w, %s", errUploadRequest, err.Error())
+		}
+		if part.FormName() == uploadChecksumName && part.FileName() == "" {
+			value, _ := io.ReadAll(io.LimitReader(part, 256))
+			checksum = string(value)
+			part.Close()
+			continue
+		}
+		if part.FormName() != uploadFormName || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		result := uploadResult{Name: filepath.Base(part.FileName())}
+		if checksum == "" {
+			checksum = r.Header.Get("X-Checksum-SHA256")
+		}
+		digest, err := uploadSha256(checksum)
+		checksum = ""
+
+		if err == nil {
+			// refuse early instead of after the whole file was transferred
+			_, result.Conflict, err = uploadTarget(osPath, result.Name, f.uploadConflict)
+		}
+		if err == nil {
+			var temp string
+			temp, err = f.uploadWrite(part, &result, digest)
+			if err == nil {
+				temps[len(results)] = temp
+			}
+		}
+		part.Close()
+		if err != nil {
+			uploadFail(&result, err)
+		}
+		results = append(results, result)
+	}
+
+	if bodyDigest != nil {
+		io.Copy(io.Discard, r.Body)
+		if err := bodyDigest.Verify(); err != nil {
+			for i := range results {
+				if results[i].Error == "" {
+					uploadFail(&results[i], err)
+				}
+			}
+		}
+	}
+
+	for i := range results {
+		result := &results[i]
+		if temp, ok := temps[i]; ok && result.Error == "" {
+			if err := f.uploadCommit(temp, osPath, result); err != nil {
+				uploadFail(result, err)
+			} else {
+				delete(temps, i)
+			}
+		}
+		if result.Error != "" {
+			logs.Error("http server upload %s to %s fail, %s", result.Name, osPath, result.Error)
+		} else {
+			logs.Info("http server upload %s to %s as %s, %d bytes", result.Name, osPath, result.SavedAs, result.Size)
+		}
+	}
+
+	if uploadAcceptJson(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(uploadStatus(results))
+		return json.NewEncoder(w).Encode(results)
+	}
+	if len(results) == 0 {
+		w.Header().Set("Location", r.URL.String())
+		w.WriteHeader(http.StatusSeeOther)
+		return nil
+	}
+	return f.serveDir(w, r, osPath, results)
+}
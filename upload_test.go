@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testUploadPart struct {
+	field string
+	name  string
+	body  string
+}
+
+// testUploadBody encodes the parts like the upload form of the listing
+func testUploadBody(t *testing.T, parts []testUploadPart) (string, string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range parts {
+		var err error
+		if part.name == "" {
+			err = writer.WriteField(part.field, part.body)
+		} else {
+			var out interface{ Write([]byte) (int, error) }
+			out, err = writer.CreateFormFile(part.field, part.name)
+			if err == nil {
+				_, err = out.Write([]byte(part.body))
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return body.String(), writer.FormDataContentType()
+}
+
+func TestUploadMultipart(t *testing.T) {
+	dir := t.TempDir()
+	f := &fileHandler{route: "/", path: dir, allowUpload: true, uploads: newTusUploads()}
+
+	body, contentType := testUploadBody(t, []testUploadPart{
+		{"file", "a.txt", "first"},
+		{"comment", "", "not a file"},
+		{"file", "../b.txt", "second"},
+	})
+	w := testServe(t, f, http.MethodPost, "/", body, map[string]string{
+		"Content-Type": contentType,
+		"Accept":       "application/json",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST = %d, want %d", w.Code, http.StatusOK)
+	}
+	var results []uploadResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("POST answer %q, %v", w.Body.String(), err)
+	}
+	if len(results) != 2 || results[0].Name != "a.txt" || results[0].Size != 5 ||
+		results[1].Name != "b.txt" || results[1].Size != 6 {
+		t.Fatalf("POST results = %+v", results)
+	}
+	for name, want := range map[string]string{"a.txt": "first", "b.txt": "second"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	// a browser gets the listing with the result table
+	body, contentType = testUploadBody(t, []testUploadPart{{"file", "c.txt", "third"}})
+	w = testServe(t, f, http.MethodPost, "/", body, map[string]string{"Content-Type": contentType})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Uploaded") || !strings.Contains(w.Body.String(), "c.txt") {
+		t.Errorf("POST from the form = %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestUploadStatus(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty, emptyType := testUploadBody(t, []testUploadPart{{"comment", "", "no file"}})
+
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		contentType string
+		upload      bool
+		want        int
+	}{
+		{"url encoded form", "/", "file=a.txt", "application/x-www-form-urlencoded", true, http.StatusBadRequest},
+		{"no content type", "/", "file", "", true, http.StatusBadRequest},
+		{"broken multipart", "/", "--x\r\nno header colon\r\n\r\nbody\r\n--x--\r\n", "multipart/form-data; boundary=x", true, http.StatusBadRequest},
+		{"no file part", "/", empty, emptyType, true, http.StatusSeeOther},
+		{"upload switched off", "/", empty, emptyType, false, http.StatusForbidden},
+		{"missing folder", "/missing/", empty, emptyType, true, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		f := &fileHandler{route: "/", path: dir, allowUpload: test.upload, uploads: newTusUploads()}
+		w := testServe(t, f, http.MethodPost, test.target, test.body, map[string]string{"Content-Type": test.contentType})
+		if w.Code != test.want {
+			t.Errorf("%s: POST %s = %d, want %d", test.name, test.target, w.Code, test.want)
+		}
+	}
+}
+
+func TestUploadTarget(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "b (1).txt", "c"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		policy   string
+		want     string
+		conflict string
+		err      error
+	}{
+		{"new.txt", UploadConflictReject, "new.txt", "", nil},
+		{"a.txt", UploadConflictOverwrite, "a.txt", "overwritten", nil},
+		{"a.txt", "", "a.txt", "overwritten", nil},
+		{"a.txt", UploadConflictRename, "a (1).txt", "renamed", nil},
+		{"b.txt", UploadConflictRename, "b (2).txt", "renamed", nil},
+		{"c", UploadConflictRename, "c (1)", "renamed", nil},
+		{"a.txt", UploadConflictReject, "", "rejected", errUploadConflict},
+	}
+	for _, test := range tests {
+		outPath, conflict, err := uploadTarget(dir, test.name, test.policy)
+		if !errors.Is(err, test.err) {
+			t.Errorf("uploadTarget(%q, %q) error = %v, want %v", test.name, test.policy, err, test.err)
+			continue
+		}
+		want := ""
+		if test.want != "" {
+			want = filepath.Join(dir, test.want)
+		}
+		if outPath != want || conflict != test.conflict {
+			t.Errorf("uploadTarget(%q, %q) = %q, %q, want %q, %q",
+				test.name, test.policy, outPath, conflict, want, test.conflict)
+		}
+	}
+}
+
+func TestUploadConflictPolicy(t *testing.T) {
+	tests := []struct {
+		policy   string
+		status   int
+		conflict string
+		savedAs  string
+		content  map[string]string
+	}{
+		{UploadConflictOverwrite, http.StatusOK, "overwritten", "a.txt", map[string]string{"a.txt": "new"}},
+		{UploadConflictRename, http.StatusOK, "renamed", "a (1).txt", map[string]string{"a.txt": "old", "a (1).txt": "new"}},
+		{UploadConflictReject, http.StatusConflict, "rejected", "", map[string]string{"a.txt": "old"}},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f := &fileHandler{route: "/", path: dir, allowUpload: true, uploadConflict: test.policy, uploads: newTusUploads()}
+
+		body, contentType := testUploadBody(t, []testUploadPart{{"file", "a.txt", "new"}})
+		w := testServe(t, f, http.MethodPost, "/", body, map[string]string{
+			"Content-Type": contentType,
+			"Accept":       "application/json",
+		})
+		var results []uploadResult
+		if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil || len(results) != 1 {
+			t.Fatalf("%s: POST answer %q, %v", test.policy, w.Body.String(), err)
+		}
+		if w.Code != test.status || results[0].Conflict != test.conflict || results[0].SavedAs != test.savedAs {
+			t.Errorf("%s: POST = %d %+v, want %d conflict %q saved as %q",
+				test.policy, w.Code, results[0], test.status, test.conflict, test.savedAs)
+		}
+		for name, want := range test.content {
+			got, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil || string(got) != want {
+				t.Errorf("%s: %s = %q, %v, want %q", test.policy, name, got, err, want)
+			}
+		}
+	}
+}
+
+func TestUploadStagePath(t *testing.T) {
+	tests := []struct {
+		urlPath string
+		want    bool
+	}{
+		{"/", false},
+		{"/" + uploadStageDir, true},
+		{uploadStageDir, true},
+		{"/" + uploadStageDir + "/", true},
+		{"/" + uploadStageDir + "/abc.upload", true},
+		{"/docs/../" + uploadStageDir + "/abc.info", true},
+		{"//" + uploadStageDir, true},
+		{"/" + uploadStageDir + "-old", false},
+		{"/docs/" + uploadStageDir, false},
+	}
+	for _, test := range tests {
+		if got := uploadStagePath(test.urlPath); got != test.want {
+			t.Errorf("uploadStagePath(%q) = %v, want %v", test.urlPath, got, test.want)
+		}
+	}
+}
+
+func TestUploadChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+	good := hex.EncodeToString(sum[:])
+	bad := strings.Repeat("0", len(good))
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	tests := []struct {
+		name   string
+		parts  []testUploadPart
+		header map[string]string
+		status int
+		saved  bool
+	}{
+		{"no checksum", []testUploadPart{{"file", "a.txt", "content"}}, nil, http.StatusOK, true},
+		{"form field", []testUploadPart{{"sha256", "", good}, {"file", "a.txt", "content"}}, nil, http.StatusOK, true},
+		{"form field mismatch", []testUploadPart{{"sha256", "", bad}, {"file", "a.txt", "content"}}, nil, http.StatusBadRequest, false},
+		{"form field not hex", []testUploadPart{{"sha256", "", "xyz"}, {"file", "a.txt", "content"}}, nil, http.StatusBadRequest, false},
+		{"header", []testUploadPart{{"file", "a.txt", "content"}}, map[string]string{"X-Checksum-SHA256": good}, http.StatusOK, true},
+		{"header mismatch", []testUploadPart{{"file", "a.txt", "content"}}, map[string]string{"X-Checksum-SHA256": bad}, http.StatusBadRequest, false},
+		{"content digest mismatch", []testUploadPart{{"file", "a.txt", "content"}}, map[string]string{"Content-Digest": digest}, http.StatusBadRequest, false},
+		{"content digest invalid", []testUploadPart{{"file", "a.txt", "content"}}, map[string]string{"Content-Digest": "sha-256=:abc:"}, http.StatusBadRequest, false},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		f := &fileHandler{route: "/", path: dir, allowUpload: true, uploads: newTusUploads()}
+
+		// the digest of the whole body never matches the digest of one part
+		body, contentType := testUploadBody(t, test.parts)
+		header := map[string]string{"Content-Type": contentType, "Accept": "application/json"}
+		for name, value := range test.header {
+			header[name] = value
+		}
+		w := testServe(t, f, http.MethodPost, "/", body, header)
+		if w.Code != test.status {
+			t.Errorf("%s: POST = %d %q, want %d", test.name, w.Code, w.Body.String(), test.status)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "a.txt")); (err == nil) != test.saved {
+			t.Errorf("%s: a.txt saved %v, want %v", test.name, err == nil, test.saved)
+		}
+		// nothing is left behind in the stage folder either way
+		files, _ := os.ReadDir(filepath.Join(dir, uploadStageDir))
+		if len(files) != 0 {
+			t.Errorf("%s: stage folder keeps %d files", test.name, len(files))
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/astaxie/beego/logs"
@@ -11,10 +12,13 @@ import (
 )
 
 type UserItem struct {
-	Index    int
-	UserName string
-	Password string
+	Index      int
+	UserName   string
+	Permission string
+	PathRules  string
+	ClientCert string
 
+	user    UserInfo
 	checked bool
 }
 
@@ -41,7 +45,11 @@ func (n *UserTable) Value(row, col int) interface{} {
 	case 1:
 		return item.UserName
 	case 2:
-		return item.Password
+		return item.Permission
+	case 3:
+		return item.PathRules
+	case 4:
+		return item.ClientCert
 	}
 	panic("unexpected col")
 }
@@ -71,7 +79,11 @@ func (m *UserTable) Sort(col int, order walk.SortOrder) error {
 		case 1:
 			return c(a.UserName < b.UserName)
 		case 2:
-			return c(a.Password < b.Password)
+			return c(a.Permission < b.Permission)
+		case 3:
+			return c(a.PathRules < b.PathRules)
+		case 4:
+			return c(a.ClientCert < b.ClientCert)
 		}
 		panic("unreachable")
 	})
@@ -84,7 +96,14 @@ var tableView *walk.TableView
 func UserTableInit(userList []UserInfo) {
 	item := make([]*UserItem, 0)
 	for i, user := range userList {
-		item = append(item, &UserItem{Index: i, UserName: user.UserName, Password: user.Password})
+		item = append(item, &UserItem{
+			Index:      i,
+			UserName:   user.UserName,
+			Permission: PermissionFormat(user.Permissions),
+			PathRules:  PathRulesFormat(user.PathRules),
+			ClientCert: user.ClientCert,
+			user:       user,
+		})
 	}
 	userTable.items = item
 
@@ -92,22 +111,48 @@ func UserTableInit(userList []UserInfo) {
 	userTable.Sort(userTable.sortColumn, userTable.sortOrder)
 }
 
-func UserTableAdd(username, password string) error {
+// UserTableAdd adds or updates a user, an empty password keeps the stored
+// one of an existing user. Only the hash of the password is stored, a user
+// with a client cert identity may go without a password.
+func UserTableAdd(username, password, clientCert string, permissions []string, rules []PathRule) error {
 	userTable.Lock()
 	defer userTable.Unlock()
 
+	var hashed string
+	if password != "" {
+		var err error
+		hashed, err = PasswordHash(password)
+		if err != nil {
+			return err
+		}
+	}
+
 	userList := ConfigGet().AuthUsers
 
 	var exist bool
 	for i, user := range userList {
 		if user.UserName == username {
-			userList[i].Password = password
+			if hashed != "" {
+				userList[i].Password = hashed
+			}
+			userList[i].Permissions = permissions
+			userList[i].PathRules = rules
+			userList[i].ClientCert = clientCert
 			exist = true
 		}
 	}
 
 	if !exist {
-		userList = append(userList, UserInfo{UserName: username, Password: password})
+		if hashed == "" && clientCert == "" {
+			return fmt.Errorf("please input the password or the client cert of the new user")
+		}
+		userList = append(userList, UserInfo{
+			UserName:    username,
+			Password:    hashed,
+			Permissions: permissions,
+			PathRules:   rules,
+			ClientCert:  clientCert,
+		})
 	}
 
 	UserTableInit(userList)
@@ -121,7 +166,7 @@ func UserTableDelete() error {
 	userList := make([]UserInfo, 0)
 	for _, items := range userTable.items {
 		if !items.checked {
-			userList = append(userList, UserInfo{UserName: items.UserName, Password: items.Password})
+			userList = append(userList, items.user)
 		}
 	}
 
@@ -136,7 +181,20 @@ func UserTableDelete() error {
 func UsersAction() {
 	var dlg *walk.Dialog
 	var addPB, deletePB, acceptPB *walk.PushButton
-	var userLine, passwdLine *walk.LineEdit
+	var userLine, passwdLine, rulesLine, certLine *walk.LineEdit
+	var lockThreshold, lockDuration, sessionExpire *walk.NumberEdit
+	var loginEnable *walk.CheckBox
+	permChecks := make([]*walk.CheckBox, len(PermissionOptions()))
+
+	permWidgets := make([]Widget, 0)
+	for i, perm := range PermissionOptions() {
+		permWidgets = append(permWidgets, CheckBox{
+			AssignTo: &permChecks[i],
+			Text:     perm,
+			Checked:  permissionHas(PermissionDefault(), perm),
+		})
+	}
+	permWidgets = append(permWidgets, HSpacer{})
 
 	userTable = new(UserTable)
 	UserTableInit(ConfigGet().AuthUsers)
@@ -147,8 +205,8 @@ func UsersAction() {
 		Icon:          walk.IconInformation(),
 		DefaultButton: &acceptPB,
 		CancelButton:  &acceptPB,
-		Size:          Size{Width: 450, Height: 300},
-		MinSize:       Size{Width: 450, Height: 300},
+		Size:          Size{Width: 750, Height: 410},
+		MinSize:       Size{Width: 750, Height: 410},
 		Layout:        VBox{},
 		Children: []Widget{
 			Composite{
@@ -180,8 +238,9 @@ func UsersAction() {
 						Text: "Password: ",
 					},
 					LineEdit{
-						AssignTo: &passwdLine,
-						Text:     "",
+						AssignTo:    &passwdLine,
+						Text:        "",
+						ToolTipText: "Only the hash is saved, leave empty to keep the password of an existing user",
 					},
 					PushButton{
 						Text: " Random Generation ",
@@ -198,6 +257,112 @@ func UsersAction() {
 							}
 						},
 					},
+					Label{
+						Text: "Permission: ",
+					},
+					Composite{
+						Layout:     HBox{MarginsZero: true},
+						ColumnSpan: 3,
+						Children:   permWidgets,
+					},
+					Label{
+						Text: "Path Rules: ",
+					},
+					LineEdit{
+						AssignTo:    &rulesLine,
+						ColumnSpan:  3,
+						Text:        "",
+						ToolTipText: "Optional, the longest matching path wins, e.g. /docs=read,zip;/drop=upload",
+					},
+					Label{
+						Text: "Client Cert: ",
+					},
+					LineEdit{
+						AssignTo:    &certLine,
+						ColumnSpan:  3,
+						Text:        "",
+						ToolTipText: "Optional, the common name, DNS, email, URI or IP of a client certificate issued by the TLS CA",
+					},
+					Label{
+						Text: "Lockout: ",
+					},
+					Composite{
+						Layout:     HBox{MarginsZero: true},
+						ColumnSpan: 3,
+						Children: []Widget{
+							NumberEdit{
+								AssignTo:    &lockThreshold,
+								Value:       float64(ConfigGet().AuthLockThreshold),
+								ToolTipText: "0~100 failed logins per address or user, 0 disables the lockout",
+								MaxValue:    100,
+								MinValue:    0,
+								OnValueChanged: func() {
+									err := AuthLockThresholdSave(int64(lockThreshold.Value()))
+									if err != nil {
+										ErrorBoxAction(dlg, err.Error())
+									}
+								},
+							},
+							Label{
+								Text: " failures, locked for ",
+							},
+							NumberEdit{
+								AssignTo:    &lockDuration,
+								Value:       float64(ConfigGet().AuthLockDuration),
+								ToolTipText: "1~86400 seconds, doubled on every further lockout",
+								MaxValue:    86400,
+								MinValue:    1,
+								OnValueChanged: func() {
+									err := AuthLockDurationSave(int64(lockDuration.Value()))
+									if err != nil {
+										ErrorBoxAction(dlg, err.Error())
+									}
+								},
+							},
+							Label{
+								Text: " seconds",
+							},
+							HSpacer{},
+						},
+					},
+					Label{
+						Text: "Login Page: ",
+					},
+					Composite{
+						Layout:     HBox{MarginsZero: true},
+						ColumnSpan: 3,
+						Children: []Widget{
+							CheckBox{
+								AssignTo:    &loginEnable,
+								Text:        "Enable, session expires after ",
+								Checked:     ConfigGet().AuthLoginEnable,
+								ToolTipText: "Browsers get a login form and a session cookie, basic auth keeps working",
+								OnCheckedChanged: func() {
+									err := AuthLoginEnableSave(loginEnable.Checked())
+									if err != nil {
+										ErrorBoxAction(dlg, err.Error())
+									}
+								},
+							},
+							NumberEdit{
+								AssignTo:    &sessionExpire,
+								Value:       float64(ConfigGet().AuthSessionExpire),
+								ToolTipText: "60~2592000 seconds",
+								MaxValue:    2592000,
+								MinValue:    60,
+								OnValueChanged: func() {
+									err := AuthSessionExpireSave(int64(sessionExpire.Value()))
+									if err != nil {
+										ErrorBoxAction(dlg, err.Error())
+									}
+								},
+							},
+							Label{
+								Text: " seconds",
+							},
+							HSpacer{},
+						},
+					},
 				},
 			},
 			Label{
@@ -211,7 +376,9 @@ func UsersAction() {
 				Columns: []TableViewColumn{
 					{Title: "#", Width: 60},
 					{Title: "UserName", Width: 150},
-					{Title: "Password", Width: 150},
+					{Title: "Permission", Width: 150},
+					{Title: "PathRules", Width: 200},
+					{Title: "ClientCert", Width: 150},
 				},
 				StyleCell: func(style *walk.CellStyle) {
 					if style.Row()%2 == 0 {
@@ -225,7 +392,12 @@ func UsersAction() {
 					index := tableView.CurrentIndex()
 					if 0 <= index && index < len(userTable.items) {
 						userLine.SetText(userTable.items[index].UserName)
-						passwdLine.SetText(userTable.items[index].Password)
+						passwdLine.SetText("")
+						rulesLine.SetText(userTable.items[index].PathRules)
+						certLine.SetText(userTable.items[index].ClientCert)
+						for i, perm := range PermissionOptions() {
+							permChecks[i].SetChecked(permissionHas(userTable.items[index].user.Permissions, perm))
+						}
 					}
 				},
 			},
@@ -239,17 +411,30 @@ func UsersAction() {
 						OnClicked: func() {
 							username := userLine.Text()
 							password := passwdLine.Text()
-							if username == "" || password == "" {
+							if username == "" {
 								ErrorBoxAction(dlg, "Please input username and password!")
 								return
 							}
-							err := UserTableAdd(username, password)
+							permissions := make([]string, 0)
+							for i, perm := range PermissionOptions() {
+								if permChecks[i].Checked() {
+									permissions = append(permissions, perm)
+								}
+							}
+							rules, err := PathRulesParse(rulesLine.Text())
+							if err != nil {
+								ErrorBoxAction(dlg, err.Error())
+								return
+							}
+							err = UserTableAdd(username, password, strings.TrimSpace(certLine.Text()), permissions, rules)
 							if err != nil {
 								ErrorBoxAction(dlg, err.Error())
 								return
 							}
 							userLine.SetText("")
 							passwdLine.SetText("")
+							rulesLine.SetText("")
+							certLine.SetText("")
 						},
 					},
 					HSpacer{},
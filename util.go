@@ -1,20 +1,12 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
 	"fmt"
-	"math/big"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/astaxie/beego/logs"
 	"github.com/lxn/walk"
@@ -126,53 +118,76 @@ func PasteClipboard(input string) error {
 	return err
 }
 
-func CreateTlsConfig(cert, key string) (*tls.Config, error) {
-	certs, err := tls.X509KeyPair([]byte(cert), []byte(key))
+const (
+	TlsSourcePem  = "pem"
+	TlsSourceFile = "file"
+	TlsSourceAcme = "acme"
+)
+
+func TlsSourceOptions() []string {
+	return []string{TlsSourcePem, TlsSourceFile, TlsSourceAcme}
+}
+
+// tlsConfigBase holds the policy shared by every certificate source
+func tlsConfigBase(info TlsInfo) (*tls.Config, error) {
+	minVersion, err := tlsVersion(info.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := tlsCipherSuites(info.CipherSuites)
 	if err != nil {
 		return nil, err
 	}
-	return &tls.Config{
-		MinVersion:   tls.VersionTLS12,
+	config := &tls.Config{
+		MinVersion:   minVersion,
 		MaxVersion:   tls.VersionTLS13,
-		Certificates: []tls.Certificate{certs},
-		ClientAuth:   tls.RequestClientCert,
-	}, nil
+		CipherSuites: suites,
+		NextProtos:   append([]string{}, info.ALPN...),
+		ClientAuth:   clientAuthType(info.ClientAuth),
+	}
+	if config.ClientAuth != tls.NoClientCert {
+		config.ClientCAs, err = ClientCAPool(info.CA)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
 }
 
-func GenerateKeyCert(addr string) (string, string) {
-	max := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, _ := rand.Int(rand.Reader, max)
-	subject := pkix.Name{
-		Organization:       []string{"simple http server windows app"},
-		OrganizationalUnit: []string{"simple http server windows app"},
-		CommonName:         "simple http server windows app",
+func CreateTlsConfig(info TlsInfo) (*tls.Config, error) {
+	certs, err := tls.X509KeyPair([]byte(info.Cert), []byte(info.Key))
+	if err != nil {
+		return nil, err
 	}
-
-	if addr == "0.0.0.0" || addr == "::" {
-		addr = "127.0.0.1"
+	config, err := tlsConfigBase(info)
+	if err != nil {
+		return nil, err
 	}
+	config.Certificates = []tls.Certificate{certs}
+	return config, nil
+}
 
-	ipAddress := make([]net.IP, 0)
-	ipAddress = append(ipAddress, net.ParseIP(addr))
-
-	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject:      subject,
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().Add(30 * 24 * time.Hour),
-		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		IPAddresses:  ipAddress,
+// CreateFileTlsConfig serves the certificate files and follows their changes
+func CreateFileTlsConfig(info TlsInfo, files *certFileWatcher) (*tls.Config, error) {
+	config, err := tlsConfigBase(info)
+	if err != nil {
+		return nil, err
 	}
-	pk, _ := rsa.GenerateKey(rand.Reader, 2048)
-
-	derBytes, _ := x509.CreateCertificate(rand.Reader, &template, &template, &pk.PublicKey, pk)
-
-	certOut := bytes.NewBuffer(make([]byte, 0))
-	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-
-	keyOut := bytes.NewBuffer(make([]byte, 0))
-	pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)})
+	config.GetCertificate = files.GetCertificate
+	return config, nil
+}
 
-	return certOut.String(), keyOut.String()
+// CreateAcmeTlsConfig serves the certificates of the acme manager, the
+// acme-tls/1 protocol is offered for the tls-alpn-01 validation.
+func CreateAcmeTlsConfig(info TlsInfo, acme *acmeManager) (*tls.Config, error) {
+	config, err := tlsConfigBase(info)
+	if err != nil {
+		return nil, err
+	}
+	config.GetCertificate = acme.GetCertificate
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	config.NextProtos = append(config.NextProtos, acmeTlsAlpnProto)
+	return config, nil
 }
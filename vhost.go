@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// hostName normalizes the host header of a request or the server name of
+// a tls hello, the port, brackets and a trailing dot are dropped.
+func hostName(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+}
+
+// hostPatterns lists the names a host is looked up by, "*.example.com"
+// covers one label.
+func hostPatterns(host string) []string {
+	output := []string{host}
+	if _, parent, found := strings.Cut(host, "."); found {
+		output = append(output, "*."+parent)
+	}
+	return output
+}
+
+// HostPatternCheck accepts an ip address, a host name or a wildcard
+// "*.example.com", all in lower case and without port.
+func HostPatternCheck(host string) error {
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	name := strings.TrimPrefix(host, "*.")
+	if name == "" || name != strings.ToLower(name) || strings.ContainsAny(name, ":/*[] ") ||
+		strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+		return fmt.Errorf("virtual host %s must look like files.example.com or *.example.com", host)
+	}
+	return nil
+}
+
+func VirtualHostCheck(hosts []VirtualHost) error {
+	names := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if err := HostPatternCheck(host.Host); err != nil {
+			return err
+		}
+		if permissionHas(names, host.Host) {
+			return fmt.Errorf("virtual host %s is used twice", host.Host)
+		}
+		names = append(names, host.Host)
+
+		stat, err := os.Stat(host.Dir)
+		if err != nil {
+			return fmt.Errorf("virtual host %s folder %s, %s", host.Host, host.Dir, err.Error())
+		}
+		if !stat.IsDir() {
+			return fmt.Errorf("virtual host %s folder %s is not folder", host.Host, host.Dir)
+		}
+
+		if (host.CertFile == "") != (host.KeyFile == "") {
+			return fmt.Errorf("virtual host %s needs both the certificate and the key file", host.Host)
+		}
+		if host.CertFile != "" {
+			if _, err := tls.LoadX509KeyPair(host.CertFile, host.KeyFile); err != nil {
+				return fmt.Errorf("virtual host %s certificate, %s", host.Host, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// VirtualHostSniCerts returns the certificates of the virtual hosts which
+// have their own files, they take part in the sni selection.
+func VirtualHostSniCerts(hosts []VirtualHost) []SniCert {
+	output := make([]SniCert, 0)
+	for _, host := range hosts {
+		if host.CertFile == "" {
+			continue
+		}
+		output = append(output, SniCert{Host: host.Host, CertFile: host.CertFile, KeyFile: host.KeyFile})
+	}
+	return output
+}
+
+// hostNew creates the handler of a virtual host, the users, sessions and
+// share links are shared with the server, the mounts are not.
+func (f *fileHandler) hostNew(info VirtualHost) *fileHandler {
+	host := &fileHandler{
+		route:          "/",
+		host:           info.Host,
+		path:           info.Dir,
+		allowUpload:    info.UploadEnable,
+		allowDelete:    info.DeleteEnable,
+		allowZip:       info.ZipEnable,
+		allowAuth:      info.AuthEnable,
+		allowWebdav:    info.WebdavEnable,
+		uploadConflict: f.uploadConflict,
+		allowSite:      f.allowSite,
+		siteCleanURLs:  f.siteCleanURLs,
+		siteFallback:   f.siteFallback,
+		locks:          newDavLockSystem(),
+		uploads:        newTusUploads(),
+		userList:       f.userList,
+		passwords:      f.passwords,
+		lockout:        f.lockout,
+		login:          f.login,
+		shares:         f.shares,
+	}
+	host.root = host
+	return host
+}
+
+func (f *fileHandler) hostAdd(info VirtualHost) {
+	if f.hosts == nil {
+		f.hosts = make(map[string]*fileHandler)
+	}
+	f.hosts[info.Host] = f.hostNew(info)
+}
+
+// hostGet returns the virtual host matching the host header of the request,
+// the server itself is the default for every other name.
+func (f *fileHandler) hostGet(r *http.Request) *fileHandler {
+	if len(f.hosts) == 0 {
+		return f
+	}
+	for _, pattern := range hostPatterns(hostName(r.Host)) {
+		if host, ok := f.hosts[pattern]; ok {
+			return host
+		}
+	}
+	return f
+}
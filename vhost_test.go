@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostName(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"files.test", "files.test"},
+		{"Files.Test:8080", "files.test"},
+		{"files.test.", "files.test"},
+		{"[::1]:443", "::1"},
+		{"[::1]", "::1"},
+		{"127.0.0.1:80", "127.0.0.1"},
+	}
+	for _, test := range tests {
+		if got := hostName(test.host); got != test.want {
+			t.Errorf("hostName(%q) = %q, want %q", test.host, got, test.want)
+		}
+	}
+
+	for _, host := range []string{"files.test", "*.example.org", "127.0.0.1", "::1", "localhost"} {
+		if err := HostPatternCheck(host); err != nil {
+			t.Errorf("HostPatternCheck(%q) = %v", host, err)
+		}
+	}
+	for _, host := range []string{"", "*.", "Files.test", "files.test:80", "*.*.test", ".files.test", "files.test.", "a/b"} {
+		if err := HostPatternCheck(host); err == nil {
+			t.Errorf("HostPatternCheck(%q) succeeded", host)
+		}
+	}
+}
+
+func TestServeVirtualHosts(t *testing.T) {
+	f := shareTestHandler(t)
+	files, wild := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(files, "h.txt"), []byte("host file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wild, "w.txt"), []byte("wildcard file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.hostAdd(VirtualHost{Host: "files.test", Dir: files, UploadEnable: true, WebdavEnable: true})
+	f.hostAdd(VirtualHost{Host: "*.example.org", Dir: wild, AuthEnable: true})
+	intern := testBasicAuth("intern", "secret")
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		status int
+		body   string
+	}{
+		{"virtual host", http.MethodGet, "http://files.test/h.txt", nil, http.StatusOK, "host file"},
+		{"host with port and case", http.MethodGet, "http://FILES.test:8080/h.txt", nil, http.StatusOK, "host file"},
+		{"server dir is not on the host", http.MethodGet, "http://files.test/a.txt", nil, http.StatusNotFound, ""},
+		{"default host", http.MethodGet, "http://other.test/a.txt", intern, http.StatusOK, "a.txt"},
+		{"default host needs auth", http.MethodGet, "http://other.test/a.txt", nil, http.StatusUnauthorized, ""},
+		{"wildcard host needs auth", http.MethodGet, "http://www.example.org/w.txt", nil, http.StatusUnauthorized, ""},
+		{"wildcard host", http.MethodGet, "http://www.example.org/w.txt", intern, http.StatusOK, "wildcard file"},
+		{"wildcard covers one label", http.MethodGet, "http://a.b.example.org/w.txt", intern, http.StatusNotFound, ""},
+		{"copy to another host", "COPY", "http://files.test/h.txt", map[string]string{"Destination": "http://other.test/h2.txt"}, http.StatusBadGateway, ""},
+		{"copy on the host", "COPY", "http://files.test/h.txt", map[string]string{"Destination": "http://files.test/h2.txt"}, http.StatusCreated, ""},
+	}
+	for _, test := range tests {
+		w := testServe(t, f, test.method, test.target, "", test.header)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s: %s %s = %d %q, want %d %q", test.name, test.method, test.target, w.Code, w.Body.String(), test.status, test.body)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(files, "h2.txt")); err != nil {
+		t.Errorf("copy on the host, %v", err)
+	}
+
+	// share links only open on the virtual host they were created on
+	_, token, err := f.shares.Create("*.example.org", "/w.txt", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := "?" + shareKey + "=" + url.QueryEscape(token)
+	shareTests := []struct {
+		target string
+		status int
+	}{
+		{"http://www.example.org/w.txt", http.StatusOK},
+		{"http://mail.example.org/w.txt", http.StatusOK},
+		{"http://files.test/h.txt", http.StatusForbidden},
+		{"http://other.test/a.txt", http.StatusForbidden},
+	}
+	for _, test := range shareTests {
+		if w := testServe(t, f, http.MethodGet, test.target+query, "", nil); w.Code != test.status {
+			t.Errorf("share link of *.example.org on %s = %d, want %d", test.target, w.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+)
+
+const (
+	davLockTimeout    = 3600
+	davLockTimeoutMax = 24 * 3600
+	davXMLHeader      = `<?xml version="1.0" encoding="utf-8"?>` + "\n"
+)
+
+var davMethods = map[string]bool{
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	"PROPFIND":         true,
+	"PROPPATCH":        true,
+	"MKCOL":            true,
+	"COPY":             true,
+	"MOVE":             true,
+	"LOCK":             true,
+	"UNLOCK":           true,
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection,omitempty"`
+}
+
+type davLockEntry struct {
+	LockScope struct {
+		Exclusive struct{} `xml:"D:exclusive"`
+	} `xml:"D:lockscope"`
+	LockType struct {
+		Write struct{} `xml:"D:write"`
+	} `xml:"D:locktype"`
+}
+
+type davProp struct {
+	DisplayName   string          `xml:"D:displayname"`
+	ResourceType  davResourceType `xml:"D:resourcetype"`
+	ContentLength *int64          `xml:"D:getcontentlength,omitempty"`
+	ContentType   string          `xml:"D:getcontenttype,omitempty"`
+	LastModified  string          `xml:"D:getlastmodified"`
+	ETag          string          `xml:"D:getetag,omitempty"`
+	SupportedLock struct {
+		LockEntry davLockEntry `xml:"D:lockentry"`
+	} `xml:"D:supportedlock"`
+}
+
+type davPropStat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	PropStat davPropStat `xml:"D:propstat"`
+}
+
+type davMultiStatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	XMLNS     string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davPatchResponse struct {
+	XMLName  xml.Name `xml:"D:multistatus"`
+	XMLNS    string   `xml:"xmlns:D,attr"`
+	Response struct {
+		Href     string `xml:"D:href"`
+		PropStat struct {
+			Prop struct {
+				InnerXML string `xml:",innerxml"`
+			} `xml:"D:prop"`
+			Status string `xml:"D:status"`
+		} `xml:"D:propstat"`
+	} `xml:"D:response"`
+}
+
+type davLockInfo struct {
+	XMLName xml.Name `xml:"DAV: lockinfo"`
+	Owner   struct {
+		InnerXML string `xml:",innerxml"`
+	} `xml:"owner"`
+}
+
+type davPropNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type davPropertyUpdate struct {
+	XMLName xml.Name       `xml:"DAV: propertyupdate"`
+	Set     []davPropNames `xml:"set>prop"`
+	Remove  []davPropNames `xml:"remove>prop"`
+}
+
+type davLock struct {
+	token    string
+	root     string
+	owner    string
+	infinite bool
+	expires  time.Time
+}
+
+// davLockSystem keeps the LOCK/UNLOCK state in memory, it is only used
+// to keep WebDAV clients from overwriting each other and is dropped when
+// the server stops.
+type davLockSystem struct {
+	sync.Mutex
+	locks map[string]*davLock
+}
+
+func newDavLockSystem() *davLockSystem {
+	return &davLockSystem{locks: make(map[string]*davLock)}
+}
+
+func (l *davLock) covers(urlPath string) bool {
+	if l.root == urlPath {
+		return true
+	}
+	return l.infinite && strings.HasPrefix(urlPath, strings.TrimSuffix(l.root, "/")+"/")
+}
+
+func (s *davLockSystem) expire() {
+	now := time.Now()
+	for token, lock := range s.locks {
+		if now.After(lock.expires) {
+			delete(s.locks, token)
+		}
+	}
+}
+
+// Confirm reports whether the request may modify urlPath, which is the case
+// when no lock covers it or when the If header submits the covering token.
+// An infinite request like DELETE or MOVE of a collection also needs the
+// tokens of the locks held on its members.
+func (s *davLockSystem) Confirm(r *http.Request, urlPath string, infinite bool) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expire()
+	ifHeader := r.Header.Get("If")
+	tree := &davLock{root: urlPath, infinite: true}
+	for token, lock := range s.locks {
+		if !lock.covers(urlPath) && !(infinite && tree.covers(lock.root)) {
+			continue
+		}
+		if !strings.Contains(ifHeader, token) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *davLockSystem) Create(urlPath, owner string, infinite bool, timeout time.Duration) (*davLock, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expire()
+	for _, lock := range s.locks {
+		if lock.covers(urlPath) || (infinite && (&davLock{root: urlPath, infinite: true}).covers(lock.root)) {
+			return nil, fmt.Errorf("resource %s is locked", urlPath)
+		}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	lock := &davLock{
+		token:    "opaquelocktoken:" + hex.EncodeToString(buf),
+		root:     urlPath,
+		owner:    owner,
+		infinite: infinite,
+		expires:  time.Now().Add(timeout),
+	}
+	s.locks[lock.token] = lock
+	return lock, nil
+}
+
+func (s *davLockSystem) Refresh(r *http.Request, urlPath string, timeout time.Duration) *davLock {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expire()
+	ifHeader := r.Header.Get("If")
+	for token, lock := range s.locks {
+		if lock.covers(urlPath) && strings.Contains(ifHeader, token) {
+			lock.expires = time.Now().Add(timeout)
+			return lock
+		}
+	}
+	return nil
+}
+
+// Remove releases the lock of the token, the lock must cover urlPath so a
+// token can not be used to unlock it through another resource.
+func (s *davLockSystem) Remove(token, urlPath string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	lock, ok := s.locks[token]
+	if !ok || !lock.covers(urlPath) {
+		return false
+	}
+	delete(s.locks, token)
+	return true
+}
+
+func davTimeout(r *http.Request) time.Duration {
+	for _, item := range strings.Split(r.Header.Get("Timeout"), ",") {
+		item = strings.TrimSpace(item)
+		if !strings.HasPrefix(item, "Second-") {
+			continue
+		}
+		var seconds int64
+		if _, err := fmt.Sscanf(item, "Second-%d", &seconds); err != nil || seconds <= 0 {
+			continue
+		}
+		if seconds > davLockTimeoutMax {
+			seconds = davLockTimeoutMax
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	return davLockTimeout * time.Second
+}
+
+func davHref(urlPath string, isDir bool) string {
+	if isDir && !strings.HasSuffix(urlPath, "/") {
+		urlPath += "/"
+	}
+	return (&url.URL{Path: urlPath}).EscapedPath()
+}
+
+func davPropGet(urlPath string, info os.FileInfo) davResponse {
+	prop := davProp{
+		DisplayName:  info.Name(),
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+	}
+	if info.IsDir() {
+		prop.ResourceType.Collection = &struct{}{}
+	} else {
+		size := info.Size()
+		prop.ContentLength = &size
+		prop.ContentType = mime.TypeByExtension(filepath.Ext(info.Name()))
+		if prop.ContentType == "" {
+			prop.ContentType = "application/octet-stream"
+		}
+		prop.ETag = fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), size)
+	}
+	return davResponse{
+		Href: davHref(urlPath, info.IsDir()),
+		PropStat: davPropStat{
+			Prop:   prop,
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+func davWriteXML(w http.ResponseWriter, status int, body interface{}) error {
+	value, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = w.Write(append([]byte(davXMLHeader), value...))
+	return err
+}
+
+func davCopyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func davCopy(src, dst string, recursive bool) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return davCopyFile(src, dst, info.Mode().Perm())
+	}
+	if !recursive {
+		return os.Mkdir(dst, info.Mode().Perm())
+	}
+	return filepath.Walk(src, func(osPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, osPath)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		return davCopyFile(osPath, target, info.Mode().Perm())
+	})
+}
+
+// davWriteMethod reports whether the method creates or modifies resources
+// and therefore needs the upload switch.
+func davWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPut, "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK":
+		return true
+	}
+	return false
+}
+
+func (f *fileHandler) serveDavOptions(w http.ResponseWriter, r *http.Request) error {
+	urlPath := path.Clean("/" + r.URL.Path)
+	methods := []string{"OPTIONS", "GET", "HEAD", "PROPFIND"}
+	if f.permit(r, urlPath, PermUpload) {
+		methods = append(methods, "POST", "PUT", "PROPPATCH", "MKCOL", "COPY", "LOCK", "UNLOCK")
+	}
+	if f.permit(r, urlPath, PermDelete) {
+		methods = append(methods, "DELETE")
+	}
+	if f.permit(r, urlPath, PermUpload) && f.permit(r, urlPath, PermDelete) {
+		methods = append(methods, "MOVE")
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.Header().Set("DAV", "1, 2")
+	w.Header().Set("MS-Author-Via", "DAV")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (f *fileHandler) serveDavPropfind(w http.ResponseWriter, r *http.Request, urlPath, osPath string) error {
+	info, err := os.Stat(osPath)
+	if err != nil {
+		return err
+	}
+
+	// depth infinity is served as depth 1, walking a whole share for one
+	// request is what the Windows mini-redirector never asks for anyway.
+	responses := []davResponse{davPropGet(urlPath, info)}
+	if info.IsDir() && r.Header.Get("Depth") != "0" {
+		d, err := os.Open(osPath)
+		if err != nil {
+			return err
+		}
+		files, err := d.Readdir(-1)
+		d.Close()
+		if err != nil {
+			return err
+		}
+		if osPath == f.path {
+			files = uploadStageHide(files)
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+		for _, file := range files {
+			responses = append(responses, davPropGet(path.Join(urlPath, file.Name()), file))
+		}
+	}
+
+	return davWriteXML(w, http.StatusMultiStatus, davMultiStatus{
+		XMLNS:     "DAV:",
+		Responses: responses,
+	})
+}
+
+// serveDavProppatch accepts the properties without storing them, Windows
+// Explorer sets its Win32 timestamps after every PUT and refuses to finish
+// the copy when this is rejected.
+func (f *fileHandler) serveDavProppatch(w http.ResponseWriter, r *http.Request, urlPath, osPath string) error {
+	info, err := os.Stat(osPath)
+	if err != nil {
+		return err
+	}
+
+	var update davPropertyUpdate
+	if err := xml.NewDecoder(r.Body).Decode(&update); err != nil && err != io.EOF {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	}
+
+	// the names come from the client, the encoder escapes the namespaces
+	var props bytes.Buffer
+	encoder := xml.NewEncoder(&props)
+	for _, prop := range append(update.Set, update.Remove...) {
+		for _, name := range prop.Names {
+			start := xml.StartElement{
+				Name: xml.Name{Local: name.XMLName.Local},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: name.XMLName.Space}},
+			}
+			if err := encoder.EncodeToken(start); err != nil {
+				return f.serveStatus(w, r, http.StatusBadRequest)
+			}
+			if err := encoder.EncodeToken(start.End()); err != nil {
+				return f.serveStatus(w, r, http.StatusBadRequest)
+			}
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	var body davPatchResponse
+	body.XMLNS = "DAV:"
+	body.Response.Href = davHref(urlPath, info.IsDir())
+	body.Response.PropStat.Status = "HTTP/1.1 200 OK"
+	body.Response.PropStat.Prop.InnerXML = props.String()
+	return davWriteXML(w, http.StatusMultiStatus, body)
+}
+
+func (f *fileHandler) serveDavPut(w http.ResponseWriter, r *http.Request, osPath string) error {
+	info, err := os.Stat(osPath)
+	if err == nil && info.IsDir() {
+		return f.serveStatus(w, r, http.StatusMethodNotAllowed)
+	}
+	exist := err == nil
+
+	// a PUT must store the body at the requested url, so only overwrite
+	// replaces an existing file and rename is refused like reject.
+	if exist && f.uploadConflict != UploadConflictOverwrite {
+		return errUploadConflict
+	}
+
+	if _, err := os.Stat(filepath.Dir(osPath)); err != nil {
+		return f.serveStatus(w, r, http.StatusConflict)
+	}
+
+	digest, err := uploadContentDigest(r.Header.Get("Content-Digest"))
+	if err == nil && digest == nil {
+		digest, err = uploadSha256(r.Header.Get("X-Checksum-SHA256"))
+	}
+	if err != nil {
+		return err
+	}
+
+	var result uploadResult
+	temp, err := f.uploadWrite(r.Body, &result, digest)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp, osPath); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if exist {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	return nil
+}
+
+func (f *fileHandler) serveDavMkcol(w http.ResponseWriter, r *http.Request, osPath string) error {
+	if r.ContentLength > 0 {
+		return f.serveStatus(w, r, http.StatusUnsupportedMediaType)
+	}
+	if _, err := os.Stat(osPath); err == nil {
+		return f.serveStatus(w, r, http.StatusMethodNotAllowed)
+	}
+	err := os.Mkdir(osPath, 0755)
+	if os.IsNotExist(err) {
+		return f.serveStatus(w, r, http.StatusConflict)
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (f *fileHandler) serveDavDelete(w http.ResponseWriter, r *http.Request, osPath string) error {
+	if osPath == f.path {
+		return f.serveStatus(w, r, http.StatusForbidden)
+	}
+	if _, err := os.Stat(osPath); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(osPath); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (f *fileHandler) serveDavCopyMove(w http.ResponseWriter, r *http.Request, urlPath, osPath string) error {
+	dest, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || dest.Path == "" {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	}
+	destURLPath := path.Clean("/" + dest.Path)
+	if dest.Host != "" && hostName(dest.Host) != hostName(r.Host) {
+		return f.serveStatus(w, r, http.StatusBadGateway)
+	}
+	if f.root.mountGet(destURLPath) != f {
+		return f.serveStatus(w, r, http.StatusBadGateway)
+	}
+	destOSPath := f.osPathGet(destURLPath)
+	if destOSPath == osPath {
+		return f.serveStatus(w, r, http.StatusForbidden)
+	}
+	if osPath == f.path || destOSPath == f.path {
+		return f.serveStatus(w, r, http.StatusForbidden)
+	}
+	if strings.HasPrefix(destOSPath, osPath+osPathSeparator) {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	}
+	if !f.permit(r, destURLPath, PermUpload) || uploadStagePath(f.mountPath(destURLPath)) {
+		return f.serveStatus(w, r, http.StatusForbidden)
+	}
+	if !f.locks.Confirm(r, destURLPath, true) {
+		return f.serveStatus(w, r, http.StatusLocked)
+	}
+
+	if _, err := os.Stat(osPath); err != nil {
+		return err
+	}
+
+	_, err = os.Stat(destOSPath)
+	exist := err == nil
+	if exist {
+		if r.Header.Get("Overwrite") == "F" {
+			return f.serveStatus(w, r, http.StatusPreconditionFailed)
+		}
+		if err := os.RemoveAll(destOSPath); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(filepath.Dir(destOSPath)); err != nil {
+		return f.serveStatus(w, r, http.StatusConflict)
+	}
+
+	if r.Method == "MOVE" {
+		err = os.Rename(osPath, destOSPath)
+	} else {
+		err = davCopy(osPath, destOSPath, r.Header.Get("Depth") != "0")
+	}
+	if err != nil {
+		return err
+	}
+
+	logs.Info("http server webdav %s %s to %s", r.Method, urlPath, destURLPath)
+
+	if exist {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	return nil
+}
+
+func (f *fileHandler) serveDavLock(w http.ResponseWriter, r *http.Request, urlPath, osPath string) error {
+	timeout := davTimeout(r)
+
+	var lock *davLock
+	status := http.StatusOK
+
+	var info davLockInfo
+	err := xml.NewDecoder(r.Body).Decode(&info)
+	if err == io.EOF {
+		lock = f.locks.Refresh(r, urlPath, timeout)
+		if lock == nil {
+			return f.serveStatus(w, r, http.StatusPreconditionFailed)
+		}
+	} else if err != nil {
+		return f.serveStatus(w, r, http.StatusBadRequest)
+	} else {
+		lock, err = f.locks.Create(urlPath, info.Owner.InnerXML, r.Header.Get("Depth") != "0", timeout)
+		if err != nil {
+			return f.serveStatus(w, r, http.StatusLocked)
+		}
+		if _, err := os.Stat(osPath); os.IsNotExist(err) {
+			out, err := os.OpenFile(osPath, os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				f.locks.Remove(lock.token, urlPath)
+				return f.serveStatus(w, r, http.StatusConflict)
+			}
+			out.Close()
+			status = http.StatusCreated
+		}
+		w.Header().Set("Lock-Token", "<"+lock.token+">")
+	}
+
+	depth := "0"
+	if lock.infinite {
+		depth = "infinity"
+	}
+
+	body := fmt.Sprintf(`<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`+
+		`<D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope>`+
+		`<D:depth>%s</D:depth><D:owner>%s</D:owner><D:timeout>Second-%d</D:timeout>`+
+		`<D:locktoken><D:href>%s</D:href></D:locktoken><D:lockroot><D:href>%s</D:href></D:lockroot>`+
+		`</D:activelock></D:lockdiscovery></D:prop>`,
+		depth, lock.owner, int64(timeout/time.Second), lock.token, davHref(lock.root, false))
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = w.Write([]byte(davXMLHeader + body))
+	return err
+}
+
+func (f *fileHandler) serveDavUnlock(w http.ResponseWriter, r *http.Request, urlPath string) error {
+	token := strings.Trim(r.Header.Get("Lock-Token"), "<>")
+	if !f.locks.Remove(token, urlPath) {
+		return f.serveStatus(w, r, http.StatusConflict)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// serveWebdav handles the WebDAV verbs, GET, HEAD and POST keep going
+// through the normal file handler. ServeHTTP has already checked the
+// permission of the request on its own path.
+func (f *fileHandler) serveWebdav(w http.ResponseWriter, r *http.Request, urlPath, osPath string) error {
+	switch r.Method {
+	case http.MethodPut, "PROPPATCH", "MKCOL":
+		if !f.locks.Confirm(r, urlPath, false) {
+			return f.serveStatus(w, r, http.StatusLocked)
+		}
+	case http.MethodDelete, "MOVE":
+		if !f.locks.Confirm(r, urlPath, true) {
+			return f.serveStatus(w, r, http.StatusLocked)
+		}
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		return f.serveDavOptions(w, r)
+	case "PROPFIND":
+		return f.serveDavPropfind(w, r, urlPath, osPath)
+	case "PROPPATCH":
+		return f.serveDavProppatch(w, r, urlPath, osPath)
+	case http.MethodPut:
+		return f.serveDavPut(w, r, osPath)
+	case http.MethodDelete:
+		return f.serveDavDelete(w, r, osPath)
+	case "MKCOL":
+		return f.serveDavMkcol(w, r, osPath)
+	case "COPY", "MOVE":
+		return f.serveDavCopyMove(w, r, urlPath, osPath)
+	case "LOCK":
+		return f.serveDavLock(w, r, urlPath, osPath)
+	case "UNLOCK":
+		return f.serveDavUnlock(w, r, urlPath)
+	}
+	return f.serveStatus(w, r, http.StatusMethodNotAllowed)
+}
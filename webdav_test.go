@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const davLockBody = `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope>` +
+	`<D:locktype><D:write/></D:locktype><D:owner><D:href>tester</D:href></D:owner></D:lockinfo>`
+
+func davTestHandler(t *testing.T) *fileHandler {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"sub/a.txt", "sub/b.txt", "other.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := &fileHandler{
+		route:          "/",
+		path:           dir,
+		allowUpload:    true,
+		allowDelete:    true,
+		allowWebdav:    true,
+		locks:          newDavLockSystem(),
+		uploadConflict: UploadConflictOverwrite,
+	}
+	f.root = f
+	return f
+}
+
+func TestDavLockConflicts(t *testing.T) {
+	f := davTestHandler(t)
+
+	w := testServe(t, f, "LOCK", "/sub/a.txt", davLockBody, map[string]string{"Depth": "0"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("LOCK /sub/a.txt = %d, want %d", w.Code, http.StatusOK)
+	}
+	token := strings.Trim(w.Header().Get("Lock-Token"), "<>")
+	if token == "" {
+		t.Fatal("LOCK /sub/a.txt returned no Lock-Token")
+	}
+	withToken := map[string]string{"If": "(<" + token + ">)"}
+
+	steps := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		want   int
+	}{
+		{"lock again", "LOCK", "/sub/a.txt", nil, http.StatusLocked},
+		{"lock the parent tree", "LOCK", "/sub", map[string]string{"Depth": "infinity"}, http.StatusLocked},
+		{"put without token", http.MethodPut, "/sub/a.txt", nil, http.StatusLocked},
+		{"put a sibling", http.MethodPut, "/sub/c.txt", nil, http.StatusCreated},
+		{"delete the parent", http.MethodDelete, "/sub", nil, http.StatusLocked},
+		{"move the parent", "MOVE", "/sub", map[string]string{"Destination": "http://example.com/moved"}, http.StatusLocked},
+		{"copy over the locked file", "COPY", "/other.txt", map[string]string{"Destination": "http://example.com/sub/a.txt"}, http.StatusLocked},
+		{"copy over the parent", "COPY", "/other.txt", map[string]string{"Destination": "http://example.com/sub"}, http.StatusLocked},
+		{"unlock through a sibling", "UNLOCK", "/sub/b.txt", map[string]string{"Lock-Token": "<" + token + ">"}, http.StatusConflict},
+		{"unlock an unknown token", "UNLOCK", "/sub/a.txt", map[string]string{"Lock-Token": "<opaquelocktoken:0>"}, http.StatusConflict},
+		{"put with token", http.MethodPut, "/sub/a.txt", withToken, http.StatusNoContent},
+		{"unlock", "UNLOCK", "/sub/a.txt", map[string]string{"Lock-Token": "<" + token + ">"}, http.StatusNoContent},
+		{"put after unlock", http.MethodPut, "/sub/a.txt", nil, http.StatusNoContent},
+		{"delete the parent after unlock", http.MethodDelete, "/sub", nil, http.StatusNoContent},
+	}
+	for _, step := range steps {
+		body := ""
+		if step.method == "LOCK" {
+			body = davLockBody
+		}
+		w := testServe(t, f, step.method, step.target, body, step.header)
+		if w.Code != step.want {
+			t.Errorf("%s: %s %s = %d, want %d", step.name, step.method, step.target, w.Code, step.want)
+		}
+	}
+}
+
+func TestDavLockDepthInfinity(t *testing.T) {
+	f := davTestHandler(t)
+
+	w := testServe(t, f, "LOCK", "/sub", davLockBody, map[string]string{"Depth": "infinity"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("LOCK /sub = %d, want %d", w.Code, http.StatusOK)
+	}
+	token := strings.Trim(w.Header().Get("Lock-Token"), "<>")
+
+	if w := testServe(t, f, http.MethodPut, "/sub/a.txt", "x", nil); w.Code != http.StatusLocked {
+		t.Errorf("PUT of a member without token = %d, want %d", w.Code, http.StatusLocked)
+	}
+	if w := testServe(t, f, "LOCK", "/sub/b.txt", davLockBody, nil); w.Code != http.StatusLocked {
+		t.Errorf("LOCK of a member = %d, want %d", w.Code, http.StatusLocked)
+	}
+	if w := testServe(t, f, "UNLOCK", "/sub/b.txt", "", map[string]string{"Lock-Token": "<" + token + ">"}); w.Code != http.StatusNoContent {
+		t.Errorf("UNLOCK through a member of the locked tree = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if w := testServe(t, f, http.MethodPut, "/sub/a.txt", "x", nil); w.Code != http.StatusNoContent {
+		t.Errorf("PUT after unlock = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestDavProppatchEscapesNames(t *testing.T) {
+	f := davTestHandler(t)
+
+	// the namespace decodes to a value closing the element of the answer
+	body := `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:"><D:set><D:prop>` +
+		`<Z:Win32LastModifiedTime xmlns:Z="urn:x&quot;/&gt;&lt;D:injected xmlns:D=&quot;DAV:&quot;&gt;">x</Z:Win32LastModifiedTime>` +
+		`</D:prop></D:set></D:propertyupdate>`
+	w := testServe(t, f, "PROPPATCH", "/other.txt", body, nil)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPPATCH = %d, want %d", w.Code, http.StatusMultiStatus)
+	}
+
+	var names []string
+	decoder := xml.NewDecoder(w.Body)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("PROPPATCH answer is not well formed, %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			names = append(names, start.Name.Local)
+		}
+	}
+	for _, name := range names {
+		if name == "injected" {
+			t.Fatalf("PROPPATCH answer has the injected element, %v", names)
+		}
+	}
+	if len(names) == 0 || names[len(names)-1] != "status" {
+		t.Errorf("PROPPATCH answer elements = %v", names)
+	}
+}
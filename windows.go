@@ -56,6 +56,24 @@ func MenuBarInit() []MenuItem {
 				UsersAction()
 			},
 		},
+		Action{
+			Text: "Mounts Edit",
+			OnTriggered: func() {
+				MountsAction()
+			},
+		},
+		Action{
+			Text: "Hosts Edit",
+			OnTriggered: func() {
+				HostsAction()
+			},
+		},
+		Action{
+			Text: "Proxies Edit",
+			OnTriggered: func() {
+				ProxiesAction()
+			},
+		},
 		Action{
 			Text: "Mini Windows",
 			OnTriggered: func() {
@@ -71,11 +89,11 @@ func MenuBarInit() []MenuItem {
 	}
 }
 
-var listenPort, listenTimeout *walk.NumberEdit
-var listenAddr *walk.ComboBox
-var httpsEnable, authEnable, deleteEnable, uploadEnable, zipEnable, autoRun *walk.CheckBox
+var listenPort, listenTimeout, httpListenPort *walk.NumberEdit
+var listenAddr, uploadConflict *walk.ComboBox
+var httpsEnable, authEnable, deleteEnable, uploadEnable, zipEnable, webdavEnable, statusEnable, http2Enable, h2cEnable, http3Enable, httpListenEnable, httpRedirect, hstsEnable, siteEnable, siteCleanURLs, autoRun *walk.CheckBox
 var serverFolderBut, accessURL, active *walk.PushButton
-var serverFolder *walk.LineEdit
+var serverFolder, listenAddrs, siteFallback *walk.LineEdit
 var serverInstance *fileHandler
 var mutex sync.Mutex
 
@@ -126,12 +144,26 @@ func ServerStatus(flag bool) {
 	listenPort.SetEnabled(!flag)
 	listenTimeout.SetEnabled(!flag)
 	listenAddr.SetEnabled(!flag)
+	listenAddrs.SetEnabled(!flag)
+	uploadConflict.SetEnabled(!flag)
 	httpsEnable.SetEnabled(!flag)
 	authEnable.SetEnabled(!flag)
 	deleteEnable.SetEnabled(!flag)
 	uploadEnable.SetEnabled(!flag)
 	zipEnable.SetEnabled(!flag)
+	webdavEnable.SetEnabled(!flag)
+	statusEnable.SetEnabled(!flag)
+	http2Enable.SetEnabled(!flag)
+	h2cEnable.SetEnabled(!flag)
+	http3Enable.SetEnabled(!flag)
 	autoRun.SetEnabled(!flag)
+	httpListenEnable.SetEnabled(!flag)
+	httpListenPort.SetEnabled(!flag)
+	httpRedirect.SetEnabled(!flag)
+	hstsEnable.SetEnabled(!flag)
+	siteEnable.SetEnabled(!flag)
+	siteCleanURLs.SetEnabled(!flag)
+	siteFallback.SetEnabled(!flag)
 }
 
 func ServerAutoStartup() {
@@ -174,6 +206,9 @@ func ServerSwitch() {
 		err = ServerShutdown()
 	} else {
 		err = ServerStart()
+		if err == nil && len(serverInstance.ListenFailures()) > 0 {
+			err = fmt.Errorf("some addresses are not served:\r\n%s", strings.Join(serverInstance.ListenFailures(), "\r\n"))
+		}
 	}
 
 	if err != nil {
@@ -262,6 +297,29 @@ func ConsoleWidget() []Widget {
 				},
 			},
 		},
+		Label{
+			Text: "Upload Conflict: ",
+		},
+		ComboBox{
+			AssignTo: &uploadConflict,
+			CurrentIndex: func() int {
+				policy := ConfigGet().UploadConflict
+				for i, item := range UploadConflictOptions() {
+					if policy == item {
+						return i
+					}
+				}
+				return 0
+			},
+			Model:       UploadConflictOptions(),
+			ToolTipText: "Overwrite, rename to \"name (1).ext\" or reject an upload when the file exists",
+			OnCurrentIndexChanged: func() {
+				err := UploadConflictSave(uploadConflict.Text())
+				if err != nil {
+					ErrorBoxAction(mainWindow, err.Error())
+				}
+			},
+		},
 		Label{
 			Text: "Listen Address: ",
 		},
@@ -338,6 +396,137 @@ func ConsoleWidget() []Widget {
 				},
 			},
 		},
+		Label{
+			Text: "Bind Addresses: ",
+		},
+		LineEdit{
+			AssignTo:    &listenAddrs,
+			Text:        strings.Join(ConfigGet().ListenAddrs, ","),
+			ToolTipText: "Extra addresses served beside the listen address, separated by comma, e.g. 0.0.0.0,::",
+			OnEditingFinished: func() {
+				addrs, err := ListenAddrsParse(listenAddrs.Text())
+				if err != nil {
+					ErrorBoxAction(mainWindow, err.Error())
+					return
+				}
+				err = ListenAddrsSave(addrs)
+				if err != nil {
+					ErrorBoxAction(mainWindow, err.Error())
+				}
+			},
+		},
+		Label{
+			Text: "HTTP Listen: ",
+		},
+		Composite{
+			Layout: HBox{MarginsZero: true},
+			Children: []Widget{
+				CheckBox{
+					AssignTo:    &httpListenEnable,
+					Text:        "Enable",
+					Checked:     ConfigGet().HttpListenEnable,
+					ToolTipText: "Also listen for plain http when https is on",
+					OnCheckedChanged: func() {
+						err := HttpListenEnableSave(httpListenEnable.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				Label{
+					Text: "Port: ",
+				},
+				NumberEdit{
+					AssignTo:    &httpListenPort,
+					Value:       float64(ConfigGet().HttpListenPort),
+					ToolTipText: "1~65535",
+					MaxValue:    65535,
+					MinValue:    1,
+					OnValueChanged: func() {
+						err := HttpListenPortSave(int64(httpListenPort.Value()))
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				CheckBox{
+					AssignTo:    &httpRedirect,
+					Text:        "Redirect",
+					Checked:     ConfigGet().HttpRedirect,
+					ToolTipText: "Answer http requests with a 301 to the https port",
+					OnCheckedChanged: func() {
+						err := HttpRedirectSave(httpRedirect.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				CheckBox{
+					AssignTo:    &hstsEnable,
+					Text:        "HSTS",
+					Checked:     ConfigGet().HstsEnable,
+					ToolTipText: "Tell browsers to use https for a year, only with a trusted certificate",
+					OnCheckedChanged: func() {
+						err := HstsEnableSave(hstsEnable.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+			},
+		},
+		Label{
+			Text: "Site Mode: ",
+		},
+		Composite{
+			Layout: HBox{MarginsZero: true},
+			Children: []Widget{
+				CheckBox{
+					AssignTo:    &siteEnable,
+					Text:        "Enable",
+					Checked:     ConfigGet().SiteEnable,
+					ToolTipText: "Serve index.html or index.htm of a folder instead of the file list",
+					OnCheckedChanged: func() {
+						err := SiteEnableSave(siteEnable.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				CheckBox{
+					AssignTo:    &siteCleanURLs,
+					Text:        "Clean URLs",
+					Checked:     ConfigGet().SiteCleanURLs,
+					ToolTipText: "Serve /about.html for /about",
+					OnCheckedChanged: func() {
+						err := SiteCleanURLsSave(siteCleanURLs.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				Label{
+					Text: "Fallback: ",
+				},
+				LineEdit{
+					AssignTo:    &siteFallback,
+					Text:        ConfigGet().SiteFallback,
+					ToolTipText: "File served for unknown paths of a single page app, e.g. /index.html, empty is off",
+					OnEditingFinished: func() {
+						file, err := SiteFallbackParse(siteFallback.Text())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+							return
+						}
+						siteFallback.SetText(file)
+						err = SiteFallbackSave(file)
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+			},
+		},
 		VSpacer{},
 		Composite{
 			Layout: Grid{Columns: 3, MarginsZero: true},
@@ -399,6 +588,65 @@ func ConsoleWidget() []Widget {
 						}
 					},
 				},
+				CheckBox{
+					AssignTo: &webdavEnable,
+					Text:     "WebDAV Enable",
+					Checked:  ConfigGet().WebdavEnable,
+					OnCheckedChanged: func() {
+						err := WebdavEnableSave(webdavEnable.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				CheckBox{
+					AssignTo:    &statusEnable,
+					Text:        "Status Enable",
+					Checked:     ConfigGet().StatusEnable,
+					ToolTipText: "Serve the request count and certificate expiry at /.status",
+					OnCheckedChanged: func() {
+						err := StatusEnableSave(statusEnable.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				CheckBox{
+					AssignTo:    &http2Enable,
+					Text:        "HTTP/2 Enable",
+					Checked:     ConfigGet().Http2Enable,
+					ToolTipText: "Offer h2 on https listeners",
+					OnCheckedChanged: func() {
+						err := Http2EnableSave(http2Enable.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				CheckBox{
+					AssignTo:    &h2cEnable,
+					Text:        "H2C Enable",
+					Checked:     ConfigGet().H2cEnable,
+					ToolTipText: "Accept cleartext HTTP/2 with prior knowledge when https is off",
+					OnCheckedChanged: func() {
+						err := H2cEnableSave(h2cEnable.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
+				CheckBox{
+					AssignTo:    &http3Enable,
+					Text:        "HTTP/3 Enable",
+					Checked:     ConfigGet().Http3Enable,
+					ToolTipText: "Listen for QUIC on the same udp port when https is on",
+					OnCheckedChanged: func() {
+						err := Http3EnableSave(http3Enable.Checked())
+						if err != nil {
+							ErrorBoxAction(mainWindow, err.Error())
+						}
+					},
+				},
 				CheckBox{
 					AssignTo: &autoRun,
 					Text:     "Auto Startup",
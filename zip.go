@@ -32,7 +32,7 @@ func walkFunc(w *zip.Writer, basePath, path string, stat os.FileInfo) error {
 	return w.Flush()
 }
 
-func FileZip(w io.Writer, path string) error {
+func FileZip(w io.Writer, path string, exclude ...string) error {
 	basePath := path
 
 	wZip := zip.NewWriter(w)
@@ -46,6 +46,11 @@ func FileZip(w io.Writer, path string) error {
 		if err != nil {
 			return err
 		}
+		for _, item := range exclude {
+			if path == item {
+				return filepath.SkipDir
+			}
+		}
 		return walkFunc(wZip, basePath, path, info)
 	})
 }